@@ -0,0 +1,40 @@
+package blammo
+
+import "sync/atomic"
+
+// Accumulator keeps a running total of values logged under a key, for progress
+// logging in batch jobs. It's safe for concurrent use.
+type Accumulator struct {
+	total int64 // accessed atomically; first for alignment
+
+	l   *Logger
+	key string
+}
+
+// Accumulator returns a new Accumulator which logs to l under the key given.
+func (l *Logger) Accumulator(key string) *Accumulator {
+	return &Accumulator{l: l, key: key}
+}
+
+// Add adds n to the total, and returns an info level event containing n as
+// key, and the new total as key_total, for you to add a message to. For
+// example:
+//
+//	acc.Add(int64(len(batch))).Msg("batch processed")
+func (a *Accumulator) Add(n int64) *Event {
+	total := atomic.AddInt64(&a.total, n)
+	e := a.l.Info()
+	if e == nil {
+		return e
+	}
+	e.appendKey(a.key)
+	e.enc.int(e, n)
+	e.appendKeySuffix(a.key, "_total")
+	e.enc.int(e, total)
+	return e
+}
+
+// Total returns the sum of the values added so far.
+func (a *Accumulator) Total() int64 {
+	return atomic.LoadInt64(&a.total)
+}
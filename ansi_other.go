@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package blammo
+
+import "os"
+
+// EnableANSI reports whether ANSI escape codes can be written to a terminal,
+// which outside of Windows they always can.
+func enableANSI(f *os.File) bool {
+	return true
+}
@@ -0,0 +1,26 @@
+package blammo
+
+import (
+	"os"
+	"syscall"
+)
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+const enableVirtualTerminalProcessing = 0x0004
+
+// EnableANSI attempts to turn on virtual terminal processing for a Windows
+// console, so that ANSI escape codes are interpreted rather than printed. It
+// returns false if the file isn't a console, or the console doesn't support it.
+func enableANSI(f *os.File) bool {
+	h := syscall.Handle(f.Fd())
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		return false
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	r, _, _ := procSetConsoleMode.Call(uintptr(h), uintptr(mode|enableVirtualTerminalProcessing))
+	return r != 0
+}
@@ -0,0 +1,149 @@
+package blammo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Any adds a key (variable name) and a value of any type to the logging event,
+// using the Event method which suits the type of the value. Errors and types
+// with a String method are logged as strings, and anything else is formatted
+// with fmt.Sprint.
+func (e *Event) Any(key string, v interface{}) *Event {
+	if e == nil {
+		return e
+	}
+	switch v := v.(type) {
+	case nil:
+		return e.Str(key, "nil")
+	case string:
+		return e.Str(key, v)
+	case bool:
+		return e.Bool(key, v)
+	case int:
+		return e.Int(key, v)
+	case int8:
+		return e.Int8(key, v)
+	case int16:
+		return e.Int16(key, v)
+	case int32:
+		return e.Int32(key, v)
+	case int64:
+		return e.Int64(key, v)
+	case uint:
+		return e.Uint(key, v)
+	case uint8:
+		return e.Uint8(key, v)
+	case uint16:
+		return e.Uint16(key, v)
+	case uint32:
+		return e.Uint32(key, v)
+	case uint64:
+		return e.Uint64(key, v)
+	case float32:
+		return e.Float32(key, v)
+	case float64:
+		return e.Float64(key, v)
+	case time.Time:
+		return e.Time(key, v)
+	case time.Duration:
+		e.appendKey(key)
+		e.enc.duration(e, v)
+		return e
+	case []byte:
+		return e.Bytes(key, v)
+	case error:
+		return e.Str(key, v.Error())
+	case fmt.Stringer:
+		return e.Str(key, v.String())
+	}
+	return e.Str(key, fmt.Sprint(v))
+}
+
+// Change adds the old and new values of something which has changed to the
+// logging event, as key.old and key.new, using Any to write each value. If
+// Logger.OmitUnchanged is set and the values are equal, as decided by
+// reflect.DeepEqual, nothing is added.
+func (e *Event) Change(key string, old, new interface{}) *Event {
+	if e == nil {
+		return e
+	}
+	if e.omitUnchanged && reflect.DeepEqual(old, new) {
+		return e
+	}
+	return e.Object(key, func(e *Event) {
+		e.Any("old", old).Any("new", new)
+	})
+}
+
+// KeysAndValues adds alternating keys and values to the logging event, as
+// passed around by logr and similar logging APIs. Each value is added using
+// Any. Keys which aren't strings are formatted with fmt.Sprint. If there's a
+// key left over at the end, it's logged with the value MISSING.
+func (e *Event) KeysAndValues(kvs ...interface{}) *Event {
+	if e == nil {
+		return e
+	}
+	for i := 0; i < len(kvs); i += 2 {
+		key, ok := kvs[i].(string)
+		if !ok {
+			key = fmt.Sprint(kvs[i])
+		}
+		if i+1 == len(kvs) {
+			e.Str(key, "MISSING")
+			break
+		}
+		e.Any(key, kvs[i+1])
+	}
+	return e
+}
+
+// MsgTemplate writes the event with a message made from a template, in which
+// placeholders such as {user_id} are replaced by the values with matching keys
+// in kvs, which alternates keys and values as for KeysAndValues. The keys and
+// values are also added to the event as fields, so the message stays readable
+// while the values stay structured. For example:
+//
+//	l.Info().MsgTemplate("user {user_id} logged in", "user_id", 42)
+//
+// logs the message "user 42 logged in" with the field user_id=42. Placeholders
+// with no matching key are left as they are.
+func (e *Event) MsgTemplate(tmpl string, kvs ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.KeysAndValues(kvs...)
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		sb.WriteString(tmpl[:start])
+		if v, ok := templateValue(tmpl[start+1:end], kvs); ok {
+			fmt.Fprint(&sb, v)
+		} else {
+			sb.WriteString(tmpl[start : end+1])
+		}
+		tmpl = tmpl[end+1:]
+	}
+	sb.WriteString(tmpl)
+	e.send(sb.String())
+}
+
+// TemplateValue finds the value for a key in a list of keys and values.
+func templateValue(key string, kvs []interface{}) (interface{}, bool) {
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if k, ok := kvs[i].(string); ok && k == key {
+			return kvs[i+1], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,108 @@
+package blammo
+
+import (
+	"io"
+	"reflect"
+)
+
+// Batch collects events from a logger in memory, so that they can be written
+// with a single Write to each of the logger's writers, rather than one per
+// event. It's meant for code paths which log many lines at once. A Batch must
+// only be used by one goroutine at a time.
+//
+// As each Write from Flush carries several lines, writers which treat each
+// Write as one event mustn't be batched. These include unixgram loggers,
+// PrefixWriter, DigestWriter and DropWriter: a batch would get one prefix, be
+// deduplicated as a whole, or be dropped as a whole.
+type Batch struct {
+	l    *Logger
+	bufs []*batchBuffer
+}
+
+// batchBuffer holds the events batched for one writer, and like an Event,
+// where the writer came from in case Reopen replaces it before Flush.
+type batchBuffer struct {
+	w   io.Writer
+	src *io.Writer
+	gen uint64
+	buf []byte
+}
+
+func (b *batchBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// Batch returns a new Batch which logs to l. Nothing is written until Flush is
+// called.
+func (l *Logger) Batch() *Batch {
+	return &Batch{l: l}
+}
+
+// Debug returns a debug level logging event to be added to the batch.
+func (b *Batch) Debug() *Event {
+	return b.batch(b.l.Debug())
+}
+
+// Info returns an info level logging event to be added to the batch.
+func (b *Batch) Info() *Event {
+	return b.batch(b.l.Info())
+}
+
+// Warn returns a warning level logging event to be added to the batch.
+func (b *Batch) Warn() *Event {
+	return b.batch(b.l.Warn())
+}
+
+// Error returns an error level logging event to be added to the batch.
+func (b *Batch) Error() *Event {
+	return b.batch(b.l.Error())
+}
+
+// Batch redirects an event to the buffer for its writer.
+func (b *Batch) batch(e *Event) *Event {
+	if e == nil {
+		return e
+	}
+	for _, bb := range b.bufs {
+		if sameWriter(bb.w, e.out) {
+			e.out, e.src = bb, nil
+			return e
+		}
+	}
+	bb := &batchBuffer{w: e.out, src: e.src, gen: e.gen}
+	b.bufs = append(b.bufs, bb)
+	e.out, e.src = bb, nil
+	return e
+}
+
+// SameWriter reports whether two writers are the same, without panicking if
+// they're of a type which can't be compared.
+func sameWriter(a, b io.Writer) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && reflect.TypeOf(a).Comparable() && a == b
+}
+
+// Flush writes the batched events to their writers, in the order they were
+// written, with one Write per writer. It returns the first error from a
+// writer. The batch is empty afterwards, and can be used again.
+func (b *Batch) Flush() error {
+	var err error
+	b.l.wmu.RLock()
+	defer b.l.wmu.RUnlock()
+	for _, bb := range b.bufs {
+		if len(bb.buf) == 0 {
+			continue
+		}
+		w := bb.w
+		if bb.gen != b.l.reopens {
+			w = *bb.src
+		}
+		if w != nil {
+			if _, werr := w.Write(bb.buf); werr != nil && err == nil {
+				err = werr
+			}
+		}
+		bb.buf = bb.buf[:0]
+	}
+	return err
+}
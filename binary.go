@@ -0,0 +1,286 @@
+package blammo
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// The binary record format is:
+//
+//   uint32  length of the rest of the record
+//   uint8   level
+//   int64   timestamp, in nanoseconds since the Unix epoch
+//   uint32  length of the message, followed by the message
+//
+// followed by zero or more fields, each of which is:
+//
+//   uint32  length of the key, followed by the key
+//   uint8   type code
+//   uint32  length of the value, followed by the value
+//
+// All integers are big-endian. Integer, float, time and duration values are
+// always 8 bytes long; bools are a single byte.
+
+// Type codes for the values in binary log records.
+const (
+	binString = 's'
+	binInt    = 'i'
+	binUint   = 'u'
+	binFloat  = 'f'
+	binBool   = 'b'
+	binTime   = 't'
+	binBytes  = 'x'
+	binDur    = 'd'
+)
+
+// Length of the record header: record length, level and timestamp.
+const binHeaderSize = 4 + 1 + 8
+
+// ErrCorruptRecord is returned by BinaryReader when a record can't be decoded.
+var ErrCorruptRecord = errors.New("corrupt binary log record")
+
+// NewBinaryLogger creates a new logger which writes length-prefixed binary
+// records to the writer provided, for pipelines which want structured log data
+// without any text parsing. Use a BinaryReader to decode the records.
+func NewBinaryLogger(w io.Writer) *Logger {
+	return &Logger{
+		ErrorWriter:   w,
+		InfoWriter:    w,
+		DebugWriter:   nil,
+		MaxCallLevels: 3,
+		enc:           binaryEncoder{},
+	}
+}
+
+func appendUint32(dst []byte, n uint32) []byte {
+	return append(dst, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(dst []byte, n uint64) []byte {
+	return append(dst, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+		byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// binaryEncoder writes events in the binary record format.
+type binaryEncoder struct{}
+
+func (binaryEncoder) begin(e *Event, l *Logger, level Level, tag []byte) {
+	e.txt = appendUint32(e.txt, 0) // filled in by end
+	e.txt = append(e.txt, byte(level))
+	e.txt = appendUint64(e.txt, uint64(time.Now().UnixNano()))
+}
+
+func (binaryEncoder) key(e *Event, key string, suffix string) {
+	e.txt = appendUint32(e.txt, uint32(len(key)+len(suffix)))
+	e.txt = append(e.txt, key...)
+	e.txt = append(e.txt, suffix...)
+}
+
+func (binaryEncoder) str(e *Event, s string) {
+	e.txt = append(e.txt, binString)
+	e.txt = appendUint32(e.txt, uint32(len(s)))
+	e.txt = append(e.txt, s...)
+}
+
+func (binaryEncoder) int(e *Event, i int64) {
+	e.txt = append(e.txt, binInt, 0, 0, 0, 8)
+	e.txt = appendUint64(e.txt, uint64(i))
+}
+
+func (binaryEncoder) uint(e *Event, u uint64) {
+	e.txt = append(e.txt, binUint, 0, 0, 0, 8)
+	e.txt = appendUint64(e.txt, u)
+}
+
+func (binaryEncoder) float(e *Event, f float64, fmt byte, prec int, bitSize int) {
+	e.txt = append(e.txt, binFloat, 0, 0, 0, 8)
+	e.txt = appendUint64(e.txt, math.Float64bits(f))
+}
+
+func (binaryEncoder) bool(e *Event, b bool) {
+	e.txt = append(e.txt, binBool, 0, 0, 0, 1)
+	if b {
+		e.txt = append(e.txt, 1)
+	} else {
+		e.txt = append(e.txt, 0)
+	}
+}
+
+func (binaryEncoder) time(e *Event, t time.Time) {
+	e.txt = append(e.txt, binTime, 0, 0, 0, 8)
+	e.txt = appendUint64(e.txt, uint64(t.UnixNano()))
+}
+
+func (binaryEncoder) duration(e *Event, d time.Duration) {
+	e.txt = append(e.txt, binDur, 0, 0, 0, 8)
+	e.txt = appendUint64(e.txt, uint64(d))
+}
+
+func (binaryEncoder) bytes(e *Event, b []byte) {
+	e.txt = append(e.txt, binBytes)
+	e.txt = appendUint32(e.txt, uint32(len(b)))
+	e.txt = append(e.txt, b...)
+}
+
+// Decimal values are recorded as strings, so they stay exact.
+func (binaryEncoder) decimal(e *Event, units int64, scale int) {
+	e.txt = append(e.txt, binString, 0, 0, 0, 0)
+	n := len(e.txt)
+	e.txt = appendDecimal(e.txt, units, scale)
+	binary.BigEndian.PutUint32(e.txt[n-4:], uint32(len(e.txt)-n))
+}
+
+func (enc binaryEncoder) raw(e *Event, data []byte) {
+	enc.key(e, "", "")
+	e.txt = append(e.txt, binString)
+	e.txt = appendUint32(e.txt, uint32(len(data)))
+	e.txt = append(e.txt, data...)
+}
+
+// End inserts the message after the header, then fills in the record length.
+func (binaryEncoder) end(e *Event, msg string) {
+	ins := 4 + len(msg)
+	e.txt = append(e.txt, make([]byte, ins)...)
+	copy(e.txt[e.msgpos+ins:], e.txt[e.msgpos:len(e.txt)-ins])
+	binary.BigEndian.PutUint32(e.txt[e.msgpos:], uint32(len(msg)))
+	copy(e.txt[e.msgpos+4:], msg)
+	binary.BigEndian.PutUint32(e.txt, uint32(len(e.txt)-4))
+}
+
+// Record is a logging event decoded from the binary record format. Times are
+// decoded in UTC, whatever the local time zone.
+type Record struct {
+	Level   Level
+	Time    time.Time
+	Message string
+	Fields  []Field
+}
+
+// Field is a key and value from a binary log record. The value is a string,
+// int64, uint64, float64, bool, time.Time, time.Duration or []byte, depending
+// on which Event method was used to add it.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// BinaryReader reads records written by a binary logger.
+type BinaryReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+// NewBinaryReader creates a BinaryReader which reads records from r.
+func NewBinaryReader(r io.Reader) *BinaryReader {
+	return &BinaryReader{r: r}
+}
+
+// Read reads and decodes the next record. It returns io.EOF when there are no
+// more records, and io.ErrUnexpectedEOF if the input stops part way through a
+// record.
+func (br *BinaryReader) Read() (Record, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(br.r, hdr[:]); err != nil {
+		return Record{}, err
+	}
+	n := int(binary.BigEndian.Uint32(hdr[:]))
+	if cap(br.buf) < n {
+		br.buf = make([]byte, n)
+	}
+	br.buf = br.buf[:n]
+	if _, err := io.ReadFull(br.r, br.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Record{}, err
+	}
+	return decodeRecord(br.buf)
+}
+
+// binCursor steps through the contents of a binary record. Once any read runs
+// off the end of the record, bad is set and all further reads return nothing.
+type binCursor struct {
+	b   []byte
+	bad bool
+}
+
+func (c *binCursor) next(n int) []byte {
+	if c.bad || n < 0 || n > len(c.b) {
+		c.bad = true
+		return nil
+	}
+	x := c.b[:n]
+	c.b = c.b[n:]
+	return x
+}
+
+// Chunk reads a length-prefixed chunk of data.
+func (c *binCursor) chunk() []byte {
+	x := c.next(4)
+	if x == nil {
+		return nil
+	}
+	return c.next(int(binary.BigEndian.Uint32(x)))
+}
+
+// DecodeRecord decodes the body of a record, after the length prefix.
+func decodeRecord(b []byte) (Record, error) {
+	var rec Record
+	c := binCursor{b: b}
+	hdr := c.next(binHeaderSize - 4)
+	msg := c.chunk()
+	if c.bad {
+		return rec, ErrCorruptRecord
+	}
+	rec.Level = Level(hdr[0])
+	rec.Time = time.Unix(0, int64(binary.BigEndian.Uint64(hdr[1:]))).UTC()
+	rec.Message = string(msg)
+	for len(c.b) > 0 {
+		key := c.chunk()
+		typ := c.next(1)
+		val := c.chunk()
+		if c.bad {
+			return rec, ErrCorruptRecord
+		}
+		v, ok := decodeValue(typ[0], val)
+		if !ok {
+			return rec, ErrCorruptRecord
+		}
+		rec.Fields = append(rec.Fields, Field{Key: string(key), Value: v})
+	}
+	return rec, nil
+}
+
+func decodeValue(typ byte, val []byte) (interface{}, bool) {
+	switch typ {
+	case binString:
+		return string(val), true
+	case binBytes:
+		return append([]byte(nil), val...), true
+	case binBool:
+		if len(val) != 1 {
+			return nil, false
+		}
+		return val[0] != 0, true
+	}
+	if len(val) != 8 {
+		return nil, false
+	}
+	n := binary.BigEndian.Uint64(val)
+	switch typ {
+	case binInt:
+		return int64(n), true
+	case binUint:
+		return n, true
+	case binFloat:
+		return math.Float64frombits(n), true
+	case binTime:
+		return time.Unix(0, int64(n)).UTC(), true
+	case binDur:
+		return time.Duration(n), true
+	}
+	return nil, false
+}
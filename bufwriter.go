@@ -0,0 +1,67 @@
+package blammo
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+// BufferedWriter is an io.Writer which buffers log output to cut down on write
+// calls, for busy loggers writing to files or pipes. It's safe for concurrent
+// use. So that the last lines before a quiet period aren't stuck in the buffer,
+// it can flush itself once no more writes have arrived for FlushInterval.
+type BufferedWriter struct {
+	// FlushInterval is how long the writer waits after a write before flushing
+	// anything still buffered. Zero means the buffer is only written when it
+	// fills up, or when Flush or Close is called.
+	FlushInterval time.Duration
+
+	mu    sync.Mutex
+	buf   *bufio.Writer
+	timer *time.Timer
+}
+
+// NewBufferedWriter creates a BufferedWriter which writes to inner, with a
+// buffer of the size given in bytes.
+func NewBufferedWriter(inner io.Writer, size int) *BufferedWriter {
+	return &BufferedWriter{buf: bufio.NewWriterSize(inner, size)}
+}
+
+// Write adds p to the buffer, writing out the buffer first if p won't fit, and
+// restarts the idle timer.
+func (w *BufferedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.buf.Write(p)
+	if w.FlushInterval > 0 && w.buf.Buffered() > 0 {
+		if w.timer == nil {
+			w.timer = time.AfterFunc(w.FlushInterval, w.idleFlush)
+		} else {
+			w.timer.Reset(w.FlushInterval)
+		}
+	}
+	return n, err
+}
+
+func (w *BufferedWriter) idleFlush() {
+	w.Flush()
+}
+
+// Flush writes out anything in the buffer.
+func (w *BufferedWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Flush()
+}
+
+// Close stops the idle timer and flushes the buffer. It doesn't close the inner
+// writer.
+func (w *BufferedWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	return w.buf.Flush()
+}
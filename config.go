@@ -0,0 +1,214 @@
+package blammo
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// String returns the name of a logging level, as used in the level tags.
+func (lvl Level) String() string {
+	switch lvl {
+	case 0:
+		return "NONE"
+	case DebugLevel:
+		return "DEBUG"
+	case InfoLevel:
+		return "INFO"
+	case WarnLevel:
+		return "WARN"
+	case ErrorLevel:
+		return "ERROR"
+	case AuditLevel:
+		return "AUDIT"
+	}
+	return "Level(" + strconv.Itoa(int(lvl)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler, so levels are written by name
+// in JSON and other text formats.
+func (lvl Level) MarshalText() ([]byte, error) {
+	return []byte(lvl.String()), nil
+}
+
+// ParseLevel returns the level with the name given: DEBUG, INFO, WARN (or
+// WARNING), ERROR or AUDIT, in any case.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToUpper(name) {
+	case "DEBUG":
+		return DebugLevel, nil
+	case "INFO":
+		return InfoLevel, nil
+	case "WARN", "WARNING":
+		return WarnLevel, nil
+	case "ERROR":
+		return ErrorLevel, nil
+	case "AUDIT":
+		return AuditLevel, nil
+	}
+	return 0, fmt.Errorf("unknown logging level %q", name)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, using ParseLevel.
+func (lvl *Level) UnmarshalText(text []byte) error {
+	l, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*lvl = l
+	return nil
+}
+
+// LoggerConfig is a snapshot of a Logger's settings, for reporting how logging
+// is set up. It can be marshaled as JSON.
+type LoggerConfig struct {
+	Level       Level  `json:"level"`  // lowest level which is written; NONE if nothing is
+	Format      string `json:"format"` // "text", "binary", "json" or the Encoder's type
+	ErrorWriter string `json:"error_writer"`
+	InfoWriter  string `json:"info_writer"`
+	DebugWriter string `json:"debug_writer"`
+	AuditWriter string `json:"audit_writer"`
+
+	Timestamp          string   `json:"timestamp"`
+	UTC                bool     `json:"utc"`
+	CustomTimestamp    bool     `json:"custom_timestamp"` // whether TimestampFunc is set
+	TimestampAfterTag  bool     `json:"timestamp_after_tag"`
+	ErrorHook          bool     `json:"error_hook"`    // whether ErrorHook is set
+	ErrorHandler       bool     `json:"error_handler"` // whether ErrorHandler is set
+	MaxWriteSize       int      `json:"max_write_size"`
+	MaxCallLevels      int      `json:"max_call_levels"`
+	IncludeSystemFiles bool     `json:"include_system_files"`
+	MinLevel           Level    `json:"min_level"`
+	StackMinLevel      Level    `json:"stack_min_level"`
+	DisableCaller      bool     `json:"disable_caller"`
+	TrimPath           string   `json:"trim_path"`
+	NumericLevels      bool     `json:"numeric_levels"`
+	OutputLevel        Level    `json:"output_level"`
+	DurationSuffix     string   `json:"duration_suffix"`
+	HumanDurations     bool     `json:"human_durations"`
+	FastMsg            bool     `json:"fast_msg"`
+	MaxFields          int      `json:"max_fields"`
+	ShowDelta          bool     `json:"show_delta"`
+	BoolFormat         string   `json:"bool_format"`
+	NonFinite          string   `json:"non_finite"`
+	ClampFloatsMin     *float64 `json:"clamp_floats_min,omitempty"` // nil if floats have no lower limit
+	ClampFloatsMax     *float64 `json:"clamp_floats_max,omitempty"` // nil if floats have no upper limit
+	MaxErrorDepth      int      `json:"max_error_depth"`
+	OmitNilError       bool     `json:"omit_nil_error"`
+	MaxElements        int      `json:"max_elements"`
+	BytesHexMax        int      `json:"bytes_hex_max"`
+	BytesBase64Max     int      `json:"bytes_base64_max"`
+	OmitUnchanged      bool     `json:"omit_unchanged"`
+	ValidateUTF8       bool     `json:"validate_utf8"`
+	MetricSafeKeys     bool     `json:"metric_safe_keys"`
+	DigitSeparator     string   `json:"digit_separator"`
+}
+
+// Config returns a snapshot of the logger's current configuration. Writers are
+// described by file name if they're files, or by type otherwise; a writer
+// which isn't set is described as an empty string. It's safe to call while
+// other goroutines are logging or calling SetDebugWriter, SetLevel or Reopen.
+func (l *Logger) Config() LoggerConfig {
+	l.wmu.RLock()
+	defer l.wmu.RUnlock()
+	c := LoggerConfig{
+		Format:             "text",
+		ErrorWriter:        describeWriter(l.ErrorWriter),
+		InfoWriter:         describeWriter(l.InfoWriter),
+		DebugWriter:        describeWriter(l.DebugWriter),
+		AuditWriter:        describeWriter(l.AuditWriter),
+		Timestamp:          l.Timestamp,
+		UTC:                l.UTC,
+		CustomTimestamp:    l.TimestampFunc != nil,
+		TimestampAfterTag:  l.TimestampAfterTag,
+		ErrorHook:          l.ErrorHook != nil,
+		ErrorHandler:       l.ErrorHandler != nil,
+		MaxWriteSize:       l.MaxWriteSize,
+		MaxCallLevels:      l.MaxCallLevels,
+		IncludeSystemFiles: l.IncludeSystemFiles,
+		MinLevel:           l.MinLevel,
+		StackMinLevel:      l.StackMinLevel,
+		DisableCaller:      l.DisableCaller,
+		TrimPath:           l.TrimPath,
+		NumericLevels:      l.NumericLevels,
+		OutputLevel:        l.OutputLevel,
+		DurationSuffix:     l.DurationSuffix,
+		HumanDurations:     l.HumanDurations,
+		FastMsg:            l.FastMsg,
+		MaxFields:          l.MaxFields,
+		ShowDelta:          l.ShowDelta,
+		BoolFormat:         "true/false",
+		NonFinite:          "bare",
+		MaxErrorDepth:      l.MaxErrorDepth,
+		OmitNilError:       l.OmitNilError,
+		MaxElements:        l.MaxElements,
+		BytesHexMax:        l.BytesPolicy.HexMax,
+		BytesBase64Max:     l.BytesPolicy.Base64Max,
+		OmitUnchanged:      l.OmitUnchanged,
+		ValidateUTF8:       l.ValidateUTF8,
+		MetricSafeKeys:     l.MetricSafeKeys,
+		DigitSeparator:     l.DigitSeparator,
+	}
+	if l.Encoder != nil {
+		c.Format = fmt.Sprintf("%T", l.Encoder)
+	} else if _, ok := l.enc.(binaryEncoder); ok {
+		c.Format = "binary"
+	} else if _, ok := l.enc.(jsonEncoder); ok {
+		c.Format = "json"
+	}
+	switch {
+	case l.DebugWriter != nil:
+		c.Level = DebugLevel
+	case l.InfoWriter != nil:
+		c.Level = InfoLevel
+	case l.ErrorWriter != nil:
+		c.Level = WarnLevel
+	}
+	if c.Level != 0 && c.Level < l.MinLevel {
+		c.Level = l.MinLevel
+	}
+	if c.OutputLevel == 0 {
+		c.OutputLevel = InfoLevel
+	}
+	if c.MaxErrorDepth == 0 {
+		c.MaxErrorDepth = 10
+	}
+	if c.DurationSuffix == "" {
+		c.DurationSuffix = "_ms"
+	}
+	switch l.NonFinite {
+	case NonFiniteQuoted:
+		c.NonFinite = "quoted"
+	case NonFiniteNull:
+		c.NonFinite = "null"
+	}
+	switch l.BoolFormat {
+	case OneZero:
+		c.BoolFormat = "1/0"
+	case YesNo:
+		c.BoolFormat = "yes/no"
+	}
+	// Infinite bounds can't be marshaled as JSON
+	if r := l.ClampFloats; r != (FloatRange{}) {
+		if !math.IsInf(r.Min, -1) {
+			c.ClampFloatsMin = &r.Min
+		}
+		if !math.IsInf(r.Max, 1) {
+			c.ClampFloatsMax = &r.Max
+		}
+	}
+	return c
+}
+
+func describeWriter(w io.Writer) string {
+	switch w := w.(type) {
+	case nil:
+		return ""
+	case *os.File:
+		return w.Name()
+	}
+	return fmt.Sprintf("%T", w)
+}
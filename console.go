@@ -1,15 +1,22 @@
 package blammo
 
 import (
-	"encoding/hex"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/ssh/terminal"
 )
@@ -18,33 +25,218 @@ const bufferSize = 80
 
 const timestampFormat = "2006-01-02 15:04:05 "
 
+// Like time.RFC3339Nano, but without trailing zeroes removed
+const rfc3339Fixed = "2006-01-02T15:04:05.000000000Z07:00"
+
 // Levels of call stack to skip because of code internal to blammo
 const blammoLevels = 3
 
+// Level is the severity level of a logging event.
+type Level int
+
+// Logging levels, in increasing order of severity. The zero Level isn't a
+// valid logging level; Logger settings of type Level are disabled when zero.
+const (
+	DebugLevel Level = iota + 1
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	AuditLevel // for audit events, which aren't a severity but sort above all of them
+)
+
+// LevelMask is a set of logging levels.
+type LevelMask uint8
+
+// Levels returns a LevelMask containing the levels given.
+func Levels(levels ...Level) LevelMask {
+	var m LevelMask
+	for _, lvl := range levels {
+		m |= 1 << uint(lvl)
+	}
+	return m
+}
+
+// Has reports whether the mask contains a level.
+func (m LevelMask) Has(level Level) bool {
+	return m&(1<<uint(level)) != 0
+}
+
+// Syslog-style numeric severities, written in place of the level tags when
+// Logger.NumericLevels is set.
+const (
+	SeverityError   = 3
+	SeverityWarning = 4
+	SeverityNotice  = 5 // used for audit events
+	SeverityInfo    = 6
+	SeverityDebug   = 7
+)
+
+// BoolFormat selects how text loggers write boolean values.
+type BoolFormat int
+
+// Boolean formats. The zero value writes true and false.
+const (
+	TrueFalse BoolFormat = iota
+	OneZero
+	YesNo
+)
+
+// NonFiniteFormat selects how text loggers write floating point values which
+// are NaN or infinite.
+type NonFiniteFormat int
+
+// Formats for NaN and infinite values. The zero value writes NaN, +Inf and
+// -Inf as they are, which some parsers reject.
+const (
+	NonFiniteBare   NonFiniteFormat = iota
+	NonFiniteQuoted                 // "NaN", "+Inf" and "-Inf"
+	NonFiniteNull                   // null
+)
+
+// BytesPolicy chooses how Bytes() writes a slice according to its length, so
+// that small slices stay readable and large ones don't bloat the log. Slices
+// of up to HexMax bytes are written in hex, slices of up to Base64Max bytes in
+// base64, and larger slices are summarized by their length and SHA-256 digest,
+// as key_len and key_sha256. The zero BytesPolicy writes everything in hex.
+type BytesPolicy struct {
+	HexMax    int
+	Base64Max int
+}
+
+// FloatRange limits the values written by Float32(), Float64() and FloatFmt(),
+// to protect dashboards from absurd outliers. Values outside the range are
+// written as Min or Max, and @clamped=true is added to the event. The zero
+// FloatRange doesn't limit values, but otherwise both bounds apply, so that
+// {Min: 0, Max: 100} works for percentages. For a one-sided range, set the
+// other bound to an infinity, as in {Min: math.Inf(-1), Max: 1e6}. NaN is
+// never changed.
+type FloatRange struct {
+	Min float64
+	Max float64
+}
+
+// DefaultBytesPolicy writes slices of up to 64 bytes in hex, up to 4 KiB in
+// base64, and summarizes anything larger.
+var DefaultBytesPolicy = BytesPolicy{HexMax: 64, Base64Max: 4096}
+
 // Logger represents an object you can create log events from.
 type Logger struct {
+	lastEmit int64 // UnixNano time of the last event, for ShowDelta; first for alignment
+
+	wmu sync.RWMutex // guards the writers and MinLevel against changes by SetDebugWriter and SetLevel
+	levelListeners []func(old, new Level)
+	reopens uint64 // number of calls to Reopen, guarded by wmu, so events made before one can find the new writers
+	checkpoints sync.Map // checkpoint name to time.Time, for Checkpoint and Since
+
 	ErrorWriter io.Writer // where to send Error() events
 	InfoWriter  io.Writer // where to send Info() events
 	DebugWriter io.Writer // where to send Debug() events
+	AuditWriter io.Writer // where to send Audit() events
 
 	Timestamp string // format string for timestamps
 	UTC       bool // whether to write timestamps in UTC
 
+	// TimestampFunc, if set, is called to write the timestamp in place of the
+	// Timestamp format, so it can write whatever it likes or nothing.
+	TimestampFunc func(dst []byte, t time.Time) []byte
+
+	// TimestampAfterTag makes text loggers write the timestamp after the level
+	// tag, rather than at the start of the line.
+	TimestampAfterTag bool
+
+	// TimestampLevels limits timestamps to events at the levels in the mask,
+	// for example Levels(WarnLevel, ErrorLevel). Zero means all levels.
+	TimestampLevels LevelMask
+
 	MaxCallLevels int // how many call levels CallStack() should write
 	IncludeSystemFiles bool // whether to include system source files in the call stack
+	MinLevel Level // events below this level aren't logged, whatever their writer
+	StackMinLevel Level // events at or above this level get a call stack when written
+	CallerLevels LevelMask // events at the levels in the mask get the same fields as Caller() when written
+	DisableCaller bool // makes Line(), Caller() and CallStack() do nothing, to save their cost
+	TrimPath string // prefix removed from source file paths; if they don't start with it, all but the last two parts are removed
+	NumericLevels bool // whether to write @severity=n instead of the level tags
+	OutputLevel Level // level of events written by Output(); zero means InfoLevel
+	DurationSuffix string // appended to the key of DurBoth's numeric field; default "_ms"
+	HumanDurations bool // whether Dur() writes durations like 1.5s rather than as milliseconds
+
+	// LevelFunc, if set, is called with the current time for each event to get
+	// the minimum level to log, in place of MinLevel. It allows verbosity to
+	// follow a schedule, for example warnings only outside business hours.
+	LevelFunc func(t time.Time) Level
+
+	// FastMsg makes text loggers write the message at the end of the line,
+	// after the fields, rather than moving the fields along to fit it in after
+	// the level tag. It's the faster option for performance-sensitive code.
+	FastMsg bool
+
+	// MaxFields limits how many fields an event can have, as a safety valve
+	// against runaway loops. Fields past the limit are dropped, and a
+	// @fields_truncated=true field is added. Zero means no limit.
+	MaxFields int
+
+	// ShowDelta adds the time since the previous event from the same logger to
+	// each event, as @delta. It's mostly useful for eyeballing latency on the
+	// console.
+	ShowDelta bool
+
+	BoolFormat BoolFormat // how Bool() writes values in text formats
+	NonFinite NonFiniteFormat // how floats which are NaN or infinite are written in text formats
+	ClampFloats FloatRange // range which floats are clamped to; the zero value means no clamping
+
+	MaxErrorDepth int // how many wrapped errors ErrChain() writes; zero means 10
+	OmitNilError bool // whether Err() leaves out nil errors rather than writing @error=nil
+	MaxElements int // how many elements Strs() writes before summarizing the rest; zero means 100
+	BytesPolicy BytesPolicy // how Bytes() writes slices in text and JSON formats, by length
+	OmitUnchanged bool // whether Change() leaves out values which are the same
+
+	// ValidateUTF8 makes Str() replace invalid UTF-8 in values with the Unicode
+	// replacement character, so strict parsers can always read the output.
+	ValidateUTF8 bool
+
+	// MetricSafeKeys converts keys to snake_case containing only a-z, 0-9 and
+	// underscores, not starting with a digit, for metrics pipelines which only
+	// accept names of that form.
+	MetricSafeKeys bool
+
+	DigitSeparator string // separates groups of three digits written by IntGrouped(); default ","
+
+	// ErrorHook, if set, is called once for each error level event which has
+	// had an error added by Err() or ErrChain(), with the first error added and
+	// the event as it will be written. It's meant for forwarding errors to an
+	// error tracker. The line mustn't be kept after the hook returns.
+	ErrorHook func(err error, line []byte)
+
+	// ErrorHandler, if set, is called with any error writing an event,
+	// including ErrEventTooLarge.
+	ErrorHandler func(err error)
+
+	// MaxWriteSize is the largest event, in bytes, which is written. Larger
+	// events are passed to ErrorHandler as ErrEventTooLarge and dropped,
+	// rather than written in part. Zero means no limit.
+	MaxWriteSize int
 
 	ErrorTag []byte
 	WarnTag  []byte
 	InfoTag  []byte
 	DebugTag []byte
+	AuditTag []byte
 	KeyStart []byte
 	KeyEnd   []byte
 
 	Closer func()
+
+	// Encoder, if set, renders events in a format of its own instead of the
+	// logger's usual format. The timestamp and key color settings are then up
+	// to the Encoder.
+	Encoder Encoder
+
+	enc encoder // how events are rendered; nil means text
 }
 
 // Event represents the text collected for output to a given log Writer.
 type Event struct {
+	level    Level
 	txt      []byte
 	tag      []byte
 	keyStart []byte
@@ -52,7 +244,43 @@ type Event struct {
 	msgpos   int
 	callLevels int
 	withSystem bool
+	noCaller bool
+	trimPath string
+	stack    bool
+	autoCaller bool
+	skip     int
+	checkpoints *sync.Map
+	omitUnchanged bool
+	omitNilErr bool
+	floatRange FloatRange
+	clamped bool
+	durSuffix string
+	humanDur bool
+	fastMsg  bool
+	rawMsg   bool
+	boolFmt  BoolFormat
+	nonFinite NonFiniteFormat
+	errDepth int
+	maxElems int
+	bytesPolicy BytesPolicy
+	validUTF8 bool
+	metricKeys bool
+	digitSep string
+	errHook func(err error, line []byte)
+	hookErr error
+	errHandler func(err error)
+	maxWrite int
+	prefix   []byte
+	msgBuf   []byte
+	fields   int
+	maxFields int
+	limitPos int
+	enc      encoder
+	custom   Encoder
 	out      io.Writer
+	owner    *Logger
+	src      *io.Writer // the logger's writer that out was read from, or nil
+	gen      uint64 // the logger's Reopen count when out was read
 }
 
 var eventPool = &sync.Pool{
@@ -65,25 +293,33 @@ var eventPool = &sync.Pool{
 
 // NewConsoleLogger creates a new logger with output to stdout and stderr,
 // ANSI colored logging level tags, and timestamps to 1 second precision.
+// On Windows, it turns on ANSI escape code processing for the console, and if
+// that isn't possible it returns a PipeLogger instead.
 func NewConsoleLogger() *Logger {
+	if !enableANSI(os.Stdout) || !enableANSI(os.Stderr) {
+		return NewPipeLogger()
+	}
 	l := &Logger{
-		ErrorWriter:   os.Stderr,
-		InfoWriter:    os.Stdout,
-		DebugWriter:   nil,
-		Timestamp:     timestampFormat,
-		MaxCallLevels: 3,
-		ErrorTag:      []byte("[\x1b[91mERROR\x1b[0m] "),
-		WarnTag:       []byte("[\x1b[93mWARN\x1b[0m ] "),
-		InfoTag:       []byte("[\x1b[92mINFO\x1b[0m ] "),
-		DebugTag:      []byte("[\x1b[37mDEBUG\x1b[0m] "),
-		KeyStart:      []byte("\x1b[36m"),
-		KeyEnd:        []byte("\x1b[0m"),
+		ErrorWriter:    os.Stderr,
+		InfoWriter:     os.Stdout,
+		DebugWriter:    nil,
+		Timestamp:      timestampFormat,
+		MaxCallLevels:  3,
+		ErrorTag:       []byte("[\x1b[91mERROR\x1b[0m] "),
+		WarnTag:        []byte("[\x1b[93mWARN\x1b[0m ] "),
+		InfoTag:        []byte("[\x1b[92mINFO\x1b[0m ] "),
+		DebugTag:       []byte("[\x1b[37mDEBUG\x1b[0m] "),
+		AuditTag:       []byte("[\x1b[95mAUDIT\x1b[0m] "),
+		KeyStart:       []byte("\x1b[36m"),
+		KeyEnd:         []byte("\x1b[0m"),
+		HumanDurations: true,
 	}
 	return l
 }
 
 // NewPipeLogger creates a new logger with output to stdout and stderr,
-// no ANSI codes, and timestamps to 1 second precision.
+// no ANSI codes, and timestamps to 1 second precision. Writes block if the
+// process reading a pipe stops reading; see NewPipeSafeLogger.
 func NewPipeLogger() *Logger {
 	l := &Logger{
 		ErrorWriter:   os.Stderr,
@@ -95,6 +331,7 @@ func NewPipeLogger() *Logger {
 		WarnTag:       []byte("[WARN ] "),
 		InfoTag:       []byte("[INFO ] "),
 		DebugTag:      []byte("[DEBUG] "),
+		AuditTag:      []byte("[AUDIT] "),
 		KeyStart:      []byte(""),
 		KeyEnd:        []byte(""),
 	}
@@ -114,6 +351,7 @@ func NewCloudLogger() *Logger {
 		WarnTag:       []byte("[WARN ] "),
 		InfoTag:       []byte("[INFO ] "),
 		DebugTag:      []byte("[DEBUG] "),
+		AuditTag:      []byte("[AUDIT] "),
 		KeyStart:      []byte(""),
 		KeyEnd:        []byte(""),
 	}
@@ -141,6 +379,7 @@ func NewFileLogger(errlog string, infolog string) (*Logger, error) {
 		WarnTag:       []byte("[WARN ] "),
 		InfoTag:       []byte("[INFO ] "),
 		DebugTag:      []byte("[DEBUG] "),
+		AuditTag:      []byte("[AUDIT] "),
 		KeyStart:      []byte(""),
 		KeyEnd:        []byte(""),
 		Closer: func() {
@@ -171,47 +410,338 @@ func (l *Logger) Close() {
 	}
 }
 
-func (l *Logger) newEvent(w io.Writer, tag []byte) *Event {
-	if w == nil {
+// MinLevel returns the minimum level to log right now.
+func (l *Logger) minLevel() Level {
+	if l.LevelFunc != nil {
+		return l.LevelFunc(time.Now())
+	}
+	l.wmu.RLock()
+	defer l.wmu.RUnlock()
+	return l.MinLevel
+}
+
+// NewEvent makes an event which will be written to one of the logger's
+// writers, given as a pointer to the field so that it can be read safely.
+func (l *Logger) newEvent(level Level, w *io.Writer, tag []byte) *Event {
+	if level < l.minLevel() {
+		return nil
+	}
+	return l.makeEvent(level, w, tag)
+}
+
+// MakeEvent is newEvent without the minimum level check, for messages about the
+// logger itself which must be written whatever the level.
+func (l *Logger) makeEvent(level Level, w *io.Writer, tag []byte) *Event {
+	l.wmu.RLock()
+	out, gen := *w, l.reopens
+	l.wmu.RUnlock()
+	if out == nil {
 		return nil
 	}
 	e := eventPool.Get().(*Event)
+	e.level = level
 	e.keyStart = l.KeyStart
 	e.keyEnd = l.KeyEnd
-	e.out = w
+	e.out = out
+	e.owner = l
+	e.src = w
+	e.gen = gen
 	e.txt = e.txt[:0]
-	if l.Timestamp != "" {
-		if l.UTC {
-			e.txt = time.Now().UTC().AppendFormat(e.txt, l.Timestamp)
-		} else {
-			e.txt = time.Now().AppendFormat(e.txt, l.Timestamp)
-		}
+	e.enc = l.enc
+	e.custom = l.Encoder
+	if e.custom != nil {
+		e.enc = customEncoder{}
+	} else if e.enc == nil {
+		e.enc = textEncoder{}
 	}
-	e.txt = append(e.txt, tag...)
-	e.msgpos = len(e.txt)
 	e.callLevels = l.MaxCallLevels
 	e.withSystem = l.IncludeSystemFiles
+	e.noCaller = l.DisableCaller
+	e.trimPath = l.TrimPath
+	e.stack = l.StackMinLevel != 0 && level >= l.StackMinLevel
+	e.autoCaller = l.CallerLevels.Has(level)
+	e.skip = 0
+	e.checkpoints = &l.checkpoints
+	e.omitUnchanged = l.OmitUnchanged
+	e.omitNilErr = l.OmitNilError
+	e.floatRange = l.ClampFloats
+	e.clamped = false
+	e.fastMsg = l.FastMsg
+	e.rawMsg = false
+	e.boolFmt = l.BoolFormat
+	e.nonFinite = l.NonFinite
+	e.validUTF8 = l.ValidateUTF8
+	e.metricKeys = l.MetricSafeKeys
+	e.errHook = l.ErrorHook
+	e.hookErr = nil
+	e.errHandler = l.ErrorHandler
+	e.maxWrite = l.MaxWriteSize
+	e.digitSep = l.DigitSeparator
+	if e.digitSep == "" {
+		e.digitSep = ","
+	}
+	e.prefix = e.prefix[:0]
+	e.msgBuf = e.msgBuf[:0]
+	e.errDepth = l.MaxErrorDepth
+	if e.errDepth == 0 {
+		e.errDepth = 10
+	}
+	e.bytesPolicy = l.BytesPolicy
+	e.maxElems = l.MaxElements
+	if e.maxElems == 0 {
+		e.maxElems = 100
+	}
+	e.humanDur = l.HumanDurations
+	e.durSuffix = l.DurationSuffix
+	if e.durSuffix == "" {
+		e.durSuffix = "_ms"
+	}
+	// Fields written before the message position don't count towards MaxFields
+	e.maxFields = 0
+	e.limitPos = 0
+	e.enc.begin(e, l, level, tag)
+	e.msgpos = len(e.txt)
+	if l.ShowDelta {
+		now := time.Now().UnixNano()
+		if last := atomic.SwapInt64(&l.lastEmit, now); last != 0 {
+			e.appendKey("@delta")
+			e.enc.duration(e, time.Duration(now-last))
+		}
+	}
+	e.fields = 0
+	e.maxFields = l.MaxFields
 	return e
 }
 
+// Severity returns the numeric syslog severity for a logging level.
+func severity(level Level) int {
+	switch level {
+	case DebugLevel:
+		return SeverityDebug
+	case InfoLevel:
+		return SeverityInfo
+	case WarnLevel:
+		return SeverityWarning
+	case AuditLevel:
+		return SeverityNotice
+	}
+	return SeverityError
+}
+
 // Debug returns a debug level logging event you can add values and messages to
 func (l *Logger) Debug() *Event {
-	return l.newEvent(l.DebugWriter, l.DebugTag)
+	return l.newEvent(DebugLevel, &l.DebugWriter, l.DebugTag)
 }
 
 // Info returns an info level logging event you can add values and messages to
 func (l *Logger) Info() *Event {
-	return l.newEvent(l.InfoWriter, l.InfoTag)
+	return l.newEvent(InfoLevel, &l.InfoWriter, l.InfoTag)
 }
 
 // Warn returns a warning level logging event you can add values and messages to
 func (l *Logger) Warn() *Event {
-	return l.newEvent(l.ErrorWriter, l.WarnTag)
+	return l.newEvent(WarnLevel, &l.ErrorWriter, l.WarnTag)
 }
 
 // Error returns an error level logging event you can add values and messages to
 func (l *Logger) Error() *Event {
-	return l.newEvent(l.ErrorWriter, l.ErrorTag)
+	return l.newEvent(ErrorLevel, &l.ErrorWriter, l.ErrorTag)
+}
+
+// Audit returns an audit logging event you can add values and messages to. Audit
+// events go to the AuditWriter, so that they can be kept apart from operational
+// logs, and are always written with a timestamp and the file and line number
+// of the code which called Audit, whatever the other settings.
+func (l *Logger) Audit() *Event {
+	return l.audit(0)
+}
+
+// AuditSkip is Audit for functions which make audit events on behalf of their
+// callers: the file and line written are those of the code skip levels further
+// up the call stack than the code which called AuditSkip.
+func (l *Logger) AuditSkip(skip int) *Event {
+	return l.audit(skip)
+}
+
+// Audit makes an audit event, with the file and line of the code skip levels
+// above the code which called the method which called it. Files in the Go
+// installation, such as the standard log package, are passed over unless
+// IncludeSystemFiles is set.
+func (l *Logger) audit(skip int) *Event {
+	e := l.newEvent(AuditLevel, &l.AuditWriter, l.AuditTag)
+	if e == nil {
+		return e
+	}
+	var buf [16]uintptr
+	// Skip Callers, audit and its caller
+	pcs := buf[:runtime.Callers(skip+3, buf[:])]
+	goroot := runtime.GOROOT()
+	for _, pc := range pcs {
+		ci := callerAt(pc)
+		if e.withSystem || !strings.HasPrefix(ci.file, goroot) {
+			e.writeFrame(0, ci)
+			return e
+		}
+	}
+	e.Str("@file_0", "unavailable")
+	return e
+}
+
+// Writer reads one of the logger's writers, safely against SetDebugWriter.
+func (l *Logger) writer(w *io.Writer) io.Writer {
+	l.wmu.RLock()
+	defer l.wmu.RUnlock()
+	return *w
+}
+
+// SetDebugWriter changes where debug events are sent, or switches them off if
+// w is nil. Unlike setting DebugWriter directly, it's safe to call while other
+// goroutines are logging, so debugging can be switched on and off at run time.
+func (l *Logger) SetDebugWriter(w io.Writer) {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	l.DebugWriter = w
+}
+
+// Checkpoint records the current time under the name given, for Event.Since
+// to log the time elapsed since. Setting a checkpoint again restarts it. It's
+// safe to call while other goroutines are logging.
+func (l *Logger) Checkpoint(name string) {
+	l.checkpoints.Store(name, time.Now())
+}
+
+// Level returns the minimum level currently being logged, as set by MinLevel
+// or LevelFunc. Zero means all levels are logged.
+func (l *Logger) Level() Level {
+	return l.minLevel()
+}
+
+// Enabled reports whether events at a level are being written, that is whether
+// the level has a writer and isn't below the minimum level, so that work which
+// is only needed for logging can be skipped. Like Level, it's safe to call
+// while other goroutines are changing the writers or level.
+func (l *Logger) Enabled(level Level) bool {
+	var w *io.Writer
+	switch level {
+	case DebugLevel:
+		w = &l.DebugWriter
+	case InfoLevel:
+		w = &l.InfoWriter
+	case AuditLevel:
+		w = &l.AuditWriter
+	default:
+		w = &l.ErrorWriter
+	}
+	return l.writer(w) != nil && level >= l.minLevel()
+}
+
+// SetLevel changes the minimum level logged, and calls any functions
+// registered with OnLevelChange. Unlike setting MinLevel directly, it's safe
+// to call while other goroutines are logging.
+func (l *Logger) SetLevel(level Level) {
+	l.wmu.Lock()
+	old := l.MinLevel
+	l.MinLevel = level
+	listeners := l.levelListeners
+	l.wmu.Unlock()
+	if old == level {
+		return
+	}
+	for _, fn := range listeners {
+		fn(old, level)
+	}
+}
+
+// OnLevelChange registers a function to be called when SetLevel changes the
+// minimum level, with the old and new levels. It's called in the goroutine
+// which called SetLevel.
+func (l *Logger) OnLevelChange(fn func(old, new Level)) {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	l.levelListeners = append(l.levelListeners, fn)
+}
+
+// Reopen replaces the error, info and debug writers together, as
+// SetDebugWriter does for the debug writer, and then closes any old writers
+// which implement io.Closer and aren't still in use, other than stdout and
+// stderr. It's meant for reopening log files after they've been rotated by an
+// external tool. Reopen waits for writes in progress to finish before making
+// the swap, and events created before it but sent afterwards, including those
+// held in a Batch, go to the new writers, so nothing is written to a writer
+// after it's closed. Writers swapped in aren't closed by Close, as Closer only
+// knows about the originals.
+func (l *Logger) Reopen(err, info, debug io.Writer) {
+	l.wmu.Lock()
+	old := []io.Writer{l.ErrorWriter, l.InfoWriter, l.DebugWriter}
+	l.ErrorWriter = err
+	l.InfoWriter = info
+	l.DebugWriter = debug
+	l.reopens++
+	l.wmu.Unlock()
+	var closed []io.Writer
+	for _, w := range old {
+		c, ok := w.(io.Closer)
+		if !ok || w == os.Stdout || w == os.Stderr || containsWriter(closed, w) ||
+			containsWriter([]io.Writer{err, info, debug}, w) {
+			continue
+		}
+		c.Close()
+		closed = append(closed, w)
+	}
+}
+
+// ContainsWriter reports whether w is in ws.
+func containsWriter(ws []io.Writer, w io.Writer) bool {
+	for _, x := range ws {
+		if sameWriter(x, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// Event returns a logging event for the level specified, for when the level is
+// only known at run time. Anything other than a valid level is treated as
+// ErrorLevel.
+func (l *Logger) Event(level Level) *Event {
+	return l.event(level, 1)
+}
+
+// Event is Event with a number of levels of call stack to skip for the file
+// and line of audit events, as for audit.
+func (l *Logger) event(level Level, skip int) *Event {
+	switch level {
+	case DebugLevel:
+		return l.Debug()
+	case InfoLevel:
+		return l.Info()
+	case WarnLevel:
+		return l.Warn()
+	case AuditLevel:
+		return l.audit(skip)
+	}
+	return l.Error()
+}
+
+// Output writes a log event with the message s, for compatibility with code
+// written for the standard library's log.Logger. The event is at
+// Logger.OutputLevel, and includes the file and line number of the caller as
+// @file_0 and @line_0. As with log.Logger, a calldepth of 1 refers to the code
+// which called Output. A trailing newline is removed from the message.
+func (l *Logger) Output(calldepth int, s string) error {
+	lvl := l.OutputLevel
+	if lvl == 0 {
+		lvl = InfoLevel
+	}
+	e := l.event(lvl, calldepth)
+	if e == nil {
+		return nil
+	}
+	// Audit events have their caller already
+	if lvl != AuditLevel {
+		e.writeCallStack(calldepth+1, 1)
+	}
+	return e.send(strings.TrimSuffix(s, "\n"))
 }
 
 // Splice inserts a string (as byte slice) into an existing string (as byte slice),
@@ -229,10 +759,77 @@ func splice(txt []byte, ins []byte, inspos int) []byte {
 }
 
 func (e *Event) appendKey(key string) {
-	e.txt = append(e.txt, e.keyStart...)
-	e.txt = append(e.txt, []byte(key)...)
-	e.txt = append(e.txt, e.keyEnd...)
-	e.txt = append(e.txt, '=')
+	e.appendKeySuffix(key, "")
+}
+
+// AppendKeySuffix writes a key with a suffix appended, first enforcing the
+// MaxFields limit. Once the limit is exceeded, the buffer is cut back to where
+// the limit was reached before each new key, so the event stops growing.
+func (e *Event) appendKeySuffix(key string, suffix string) {
+	e.fields++
+	if e.maxFields > 0 && e.fields > e.maxFields {
+		if e.limitPos == 0 {
+			e.limitPos = len(e.txt)
+		}
+		e.txt = e.txt[:e.limitPos]
+	}
+	if len(e.prefix) > 0 {
+		key = string(e.prefix) + key
+	}
+	if e.metricKeys {
+		key = metricKey(key + suffix)
+		suffix = ""
+	}
+	e.enc.key(e, key, suffix)
+}
+
+// MetricKey converts a key to a metric-safe name matching [a-z_][a-z0-9_]*.
+// CamelCase becomes snake_case, and anything else not allowed becomes an
+// underscore.
+func metricKey(key string) string {
+	ok := key != ""
+	for i := 0; i < len(key) && ok; i++ {
+		c := key[i]
+		ok = c >= 'a' && c <= 'z' || c == '_' || c >= '0' && c <= '9' && i > 0
+	}
+	if ok {
+		return key
+	}
+	buf := make([]byte, 0, len(key)+4)
+	if key == "" || key[0] >= '0' && key[0] <= '9' {
+		buf = append(buf, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'A' && c <= 'Z':
+			if i > 0 && len(buf) > 0 && buf[len(buf)-1] != '_' {
+				prev := key[i-1]
+				lowerPrev := prev >= 'a' && prev <= 'z' || prev >= '0' && prev <= '9'
+				upperNext := i+1 < len(key) && key[i+1] >= 'a' && key[i+1] <= 'z' &&
+					prev >= 'A' && prev <= 'Z'
+				if lowerPrev || upperNext {
+					buf = append(buf, '_')
+				}
+			}
+			buf = append(buf, c+'a'-'A')
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_':
+			buf = append(buf, c)
+		default:
+			buf = append(buf, '_')
+		}
+	}
+	return string(buf)
+}
+
+// Level returns the level of the event, so that wrappers can act on it before
+// calling Msg. An event which isn't going to be logged is nil, and has level
+// zero.
+func (e *Event) Level() Level {
+	if e == nil {
+		return 0
+	}
+	return e.level
 }
 
 // Str adds a key (variable name) and string to the logging event.
@@ -240,40 +837,226 @@ func (e *Event) Str(key string, value string) *Event {
 	if e == nil {
 		return e
 	}
+	if e.validUTF8 && !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, "\uFFFD")
+	}
 	e.appendKey(key)
-	e.txt = append(e.txt, []byte(value)...)
-	e.txt = append(e.txt, ' ')
+	e.enc.str(e, value)
 	return e
 }
 
+// StrUnsafe adds a key (variable name) and string to the logging event,
+// skipping the checks and escaping which Str does: ValidateUTF8 is ignored,
+// and JSON loggers don't escape the value. It's for values known to be safe,
+// such as UUIDs and enum names. The value must be valid UTF-8 with no spaces,
+// quotes, backslashes or control characters, or the output may be unreadable.
+func (e *Event) StrUnsafe(key string, value string) *Event {
+	if e == nil {
+		return e
+	}
+	e.appendKey(key)
+	if enc, ok := e.enc.(jsonEncoder); ok {
+		enc.setColor(e, jsonStringColor)
+		e.txt = append(e.txt, '"')
+		e.txt = append(e.txt, value...)
+		e.txt = append(e.txt, '"')
+		enc.setColor(e, jsonResetColor)
+		return e
+	}
+	e.enc.str(e, value)
+	return e
+}
+
+// Strs adds a key (variable name) and slice of strings to the logging event,
+// separated by commas. At most Logger.MaxElements strings are written; if
+// there are more, the rest are summarized as ...(N more), so large slices
+// can't make huge log lines.
+func (e *Event) Strs(key string, values []string) *Event {
+	if e == nil {
+		return e
+	}
+	var sb strings.Builder
+	for i, v := range values {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		if i == e.maxElems {
+			fmt.Fprintf(&sb, "...(%d more)", len(values)-i)
+			break
+		}
+		sb.WriteString(v)
+	}
+	return e.Str(key, sb.String())
+}
+
+// Lazy adds a key (variable name) and the string returned by fn to the logging
+// event. The function is only called if the event is going to be written, so
+// there's no cost when the level is switched off. That's the only saving: it's
+// no cheaper than Str once the event exists, so it's only worth using in place
+// of working out an expensive value before calling Info(), Debug() and so on.
+func (e *Event) Lazy(key string, fn func() string) *Event {
+	if e == nil {
+		return e
+	}
+	return e.Str(key, fn())
+}
+
 // Bool adds a key (variable name) and boolean to the logging event.
 func (e *Event) Bool(key string, value bool) *Event {
 	if e == nil {
 		return e
 	}
-	if value {
-		return e.Str(key, "true")
-	}
-	return e.Str(key, "false")
+	e.appendKey(key)
+	e.enc.bool(e, value)
+	return e
 }
 
-// Bytes adds a key (variable name) and slice of bytes to the logging event in hex.
+// Bytes adds a key (variable name) and slice of bytes to the logging event in hex,
+// or as chosen by Logger.BytesPolicy. Binary loggers record the bytes as they are.
 func (e *Event) Bytes(key string, value []byte) *Event {
 	if e == nil {
 		return e
 	}
-	return e.Str(key, hex.EncodeToString(value))
+	p := e.bytesPolicy
+	if _, ok := e.enc.(binaryEncoder); ok || p.HexMax == 0 || len(value) <= p.HexMax {
+		e.appendKey(key)
+		e.enc.bytes(e, value)
+		return e
+	}
+	if len(value) <= p.Base64Max {
+		return e.Str(key, base64.StdEncoding.EncodeToString(value))
+	}
+	sum := sha256.Sum256(value)
+	e.appendKeySuffix(key, "_len")
+	e.enc.int(e, int64(len(value)))
+	e.appendKeySuffix(key, "_sha256")
+	e.enc.bytes(e, sum[:])
+	return e
 }
 
-// Err adds an error message as the @error key
+// HexDump adds a key (variable name) and slice of bytes to the logging event in
+// hex, with the bytes separated by colons for readability, like de:ad:be:ef.
+// Only text loggers group the bytes; other formats write them as Bytes does.
+func (e *Event) HexDump(key string, value []byte) *Event {
+	if e == nil {
+		return e
+	}
+	if _, ok := e.enc.(textEncoder); !ok {
+		return e.Bytes(key, value)
+	}
+	e.appendKey(key)
+	for i, b := range value {
+		if i > 0 {
+			e.txt = append(e.txt, ':')
+		}
+		e.txt = append(e.txt, hexDigits[b>>4], hexDigits[b&0xf])
+	}
+	e.txt = append(e.txt, ' ')
+	return e
+}
+
+// BinaryMarshaler adds a key (variable name) and the result of calling
+// MarshalBinary on a value to the logging event, in hex. If marshaling fails,
+// the error is logged as the value instead.
+func (e *Event) BinaryMarshaler(key string, v encoding.BinaryMarshaler) *Event {
+	if e == nil {
+		return e
+	}
+	if v == nil {
+		return e.Str(key, "nil")
+	}
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return e.Str(key, fmt.Sprintf("error marshaling value: %v", err))
+	}
+	return e.Bytes(key, data)
+}
+
+// Err adds an error message as the @error key. If the error is a multi-error,
+// such as one made by errors.Join, each of the errors it wraps is added as
+// @error_0, @error_1 and so on instead, so the event stays on one line. A nil
+// error is written as @error=nil, unless Logger.OmitNilError is set.
 func (e *Event) Err(err error) *Event {
 	if e == nil {
 		return e
 	}
+	return e.addErr(err, false)
+}
+
+// AddErr adds an error as described for Err, with the messages quoted as Go
+// strings if quote is set.
+func (e *Event) addErr(err error, quote bool) *Event {
 	if err == nil {
+		if e.omitNilErr {
+			return e
+		}
 		return e.Str("@error", "nil")
 	}
-	return e.Str("@error", err.Error())
+	if e.hookErr == nil {
+		e.hookErr = err
+	}
+	msg := func(err error) string {
+		if quote {
+			return strconv.Quote(err.Error())
+		}
+		return err.Error()
+	}
+	if me, ok := err.(interface{ Unwrap() []error }); ok {
+		for i, err := range me.Unwrap() {
+			e.Str("@error_"+strconv.Itoa(i), msg(err))
+		}
+		return e
+	}
+	return e.Str("@error", msg(err))
+}
+
+// ErrVerbose adds an error as Err does, and also the error formatted with %+v
+// as @error_detail, which includes stack traces and wrapping details from
+// errors which support verbose formatting. In text formats both the error
+// messages and the detail are quoted as Go strings, so that multi-line errors
+// stay on one line.
+func (e *Event) ErrVerbose(err error) *Event {
+	if e == nil {
+		return e
+	}
+	quote := true
+	switch e.enc.(type) {
+	case jsonEncoder, binaryEncoder:
+		quote = false
+	}
+	e.addErr(err, quote)
+	if err == nil {
+		return e
+	}
+	detail := fmt.Sprintf("%+v", err)
+	if quote {
+		detail = strconv.Quote(detail)
+	}
+	return e.Str("@error_detail", detail)
+}
+
+// ErrChain adds an error message as the @error key, followed by the message of
+// each error it wraps, as found by errors.Unwrap, as @cause_1, @cause_2 and so
+// on. At most Logger.MaxErrorDepth wrapped errors are written; if there are
+// more, @error_truncated=true is added.
+func (e *Event) ErrChain(err error) *Event {
+	if e == nil {
+		return e
+	}
+	e.Err(err)
+	if err == nil {
+		return e
+	}
+	for n := 1; ; n++ {
+		if err = errors.Unwrap(err); err == nil {
+			break
+		}
+		if n > e.errDepth {
+			return e.Bool("@error_truncated", true)
+		}
+		e.Str("@cause_"+strconv.Itoa(n), err.Error())
+	}
+	return e
 }
 
 // Float32 adds a key (variable name) and float32 to the logging event.
@@ -282,8 +1065,7 @@ func (e *Event) Float32(key string, f float32) *Event {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendFloat(e.txt, float64(f), 'G', -1, 32)
-	e.txt = append(e.txt, ' ')
+	e.enc.float(e, e.clamp(float64(f)), 'G', -1, 32)
 	return e
 }
 
@@ -293,17 +1075,67 @@ func (e *Event) Float64(key string, f float64) *Event {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendFloat(e.txt, float64(f), 'G', -1, 32)
-	e.txt = append(e.txt, ' ')
+	e.enc.float(e, e.clamp(f), 'G', -1, 32)
+	return e
+}
+
+// FloatFmt adds a key (variable name) and float64 to the logging event,
+// formatted as per strconv.FormatFloat with the format byte and precision
+// given. For example, FloatFmt("x", x, 'e', 3) logs x in scientific notation
+// with 3 digits after the decimal point.
+func (e *Event) FloatFmt(key string, f float64, fmt byte, prec int) *Event {
+	if e == nil {
+		return e
+	}
+	e.appendKey(key)
+	e.enc.float(e, e.clamp(f), fmt, prec, 64)
 	return e
 }
 
+// Clamp limits f to the logger's ClampFloats range, and notes if it did.
+func (e *Event) clamp(f float64) float64 {
+	r := e.floatRange
+	if r == (FloatRange{}) || math.IsNaN(f) {
+		return f
+	}
+	switch {
+	case f < r.Min:
+		f = r.Min
+	case f > r.Max:
+		f = r.Max
+	default:
+		return f
+	}
+	e.clamped = true
+	return f
+}
+
+// FloatSig adds a key (variable name) and float64 to the logging event,
+// rounded to the number of significant digits given, so that 1.2300000000001
+// logged with 3 digits is written as 1.23. Large and small values are written
+// in scientific notation, as for the 'g' format of strconv.FormatFloat.
+func (e *Event) FloatSig(key string, f float64, sigDigits int) *Event {
+	return e.FloatFmt(key, f, 'g', sigDigits)
+}
+
 // Int adds a key (variable name) and integer to the logging event.
 func (e *Event) Int(key string, value int) *Event {
 	if e == nil {
 		return e
 	}
-	return e.Str(key, strconv.Itoa(value))
+	e.appendKey(key)
+	e.enc.int(e, int64(value))
+	return e
+}
+
+// Uint adds a key (variable name) and unsigned integer to the logging event.
+func (e *Event) Uint(key string, value uint) *Event {
+	if e == nil {
+		return e
+	}
+	e.appendKey(key)
+	e.enc.uint(e, uint64(value))
+	return e
 }
 
 // Uint8 adds a key (variable name) and integer to the logging event.
@@ -312,19 +1144,52 @@ func (e *Event) Uint8(key string, value uint8) *Event {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendUint(e.txt, uint64(value), 10)
+	e.enc.uint(e, uint64(value))
+	return e
+}
+
+// IntGrouped adds a key (variable name) and integer to the logging event, with
+// the digits in groups of three for readability, like 1,234,567. The separator
+// is set by the logger's DigitSeparator. Only text loggers group the digits;
+// other formats write the value as Int does.
+func (e *Event) IntGrouped(key string, value int) *Event {
+	if e == nil {
+		return e
+	}
+	if _, ok := e.enc.(textEncoder); !ok {
+		return e.Int(key, value)
+	}
+	e.appendKey(key)
+	e.txt = appendGrouped(e.txt, int64(value), e.digitSep)
 	e.txt = append(e.txt, ' ')
 	return e
 }
 
+// AppendGrouped appends an integer with sep between each group of three
+// digits.
+func appendGrouped(dst []byte, i int64, sep string) []byte {
+	var buf [20]byte
+	digits := strconv.AppendInt(buf[:0], i, 10)
+	if i < 0 {
+		dst = append(dst, '-')
+		digits = digits[1:]
+	}
+	for j, d := range digits {
+		if j > 0 && (len(digits)-j)%3 == 0 {
+			dst = append(dst, sep...)
+		}
+		dst = append(dst, d)
+	}
+	return dst
+}
+
 // Int8 adds a key (variable name) and integer to the logging event.
 func (e *Event) Int8(key string, value int8) *Event {
 	if e == nil {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendInt(e.txt, int64(value), 10)
-	e.txt = append(e.txt, ' ')
+	e.enc.int(e, int64(value))
 	return e
 }
 
@@ -334,8 +1199,7 @@ func (e *Event) Uint16(key string, value uint16) *Event {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendUint(e.txt, uint64(value), 10)
-	e.txt = append(e.txt, ' ')
+	e.enc.uint(e, uint64(value))
 	return e
 }
 
@@ -345,8 +1209,7 @@ func (e *Event) Int16(key string, value int16) *Event {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendInt(e.txt, int64(value), 10)
-	e.txt = append(e.txt, ' ')
+	e.enc.int(e, int64(value))
 	return e
 }
 
@@ -356,8 +1219,7 @@ func (e *Event) Uint32(key string, value uint32) *Event {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendUint(e.txt, uint64(value), 10)
-	e.txt = append(e.txt, ' ')
+	e.enc.uint(e, uint64(value))
 	return e
 }
 
@@ -367,8 +1229,7 @@ func (e *Event) Int32(key string, value int32) *Event {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendInt(e.txt, int64(value), 10)
-	e.txt = append(e.txt, ' ')
+	e.enc.int(e, int64(value))
 	return e
 }
 
@@ -378,8 +1239,7 @@ func (e *Event) Uint64(key string, value uint64) *Event {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendUint(e.txt, value, 10)
-	e.txt = append(e.txt, ' ')
+	e.enc.uint(e, value)
 	return e
 }
 
@@ -389,8 +1249,7 @@ func (e *Event) Int64(key string, value int64) *Event {
 		return e
 	}
 	e.appendKey(key)
-	e.txt = strconv.AppendInt(e.txt, value, 10)
-	e.txt = append(e.txt, ' ')
+	e.enc.int(e, value)
 	return e
 }
 
@@ -400,15 +1259,378 @@ func (e *Event) Time(key string, value time.Time) *Event {
 		return e
 	}
 	e.appendKey(key)
-	tv, err := value.MarshalText()
-	if err != nil {
-		tv = []byte(fmt.Sprintf("error marshaling time: %v", err))
+	e.enc.time(e, value)
+	return e
+}
+
+// TimeRFC3339 adds a key (variable name) and time to the logging event, in RFC
+// 3339 format with all nine digits of the fractional seconds, whatever format
+// the logger uses for times. It's for audit records and other places where
+// the precision of a time must be explicit. Binary loggers record it as a
+// string.
+func (e *Event) TimeRFC3339(key string, t time.Time) *Event {
+	if e == nil {
+		return e
+	}
+	return e.Str(key, t.Format(rfc3339Fixed))
+}
+
+// Decimal adds a key (variable name) and fixed-point decimal number to the
+// logging event. The value logged is units / 10^scale, so units=12345 and
+// scale=2 logs 123.45. No floating point is involved, so it's suitable for
+// currency amounts and other values which must be logged exactly.
+func (e *Event) Decimal(key string, units int64, scale int) *Event {
+	if e == nil {
+		return e
+	}
+	e.appendKey(key)
+	e.enc.decimal(e, units, scale)
+	return e
+}
+
+// Dur adds a key (variable name) and duration to the logging event. If
+// Logger.HumanDurations is set, as it is for console loggers, the duration is
+// written with the most natural units, as per time.Duration.String; otherwise
+// it's written as a number of milliseconds, for machines to read.
+func (e *Event) Dur(key string, d time.Duration) *Event {
+	if e == nil {
+		return e
+	}
+	e.appendKey(key)
+	if e.humanDur {
+		e.enc.duration(e, d)
+	} else {
+		e.enc.float(e, float64(d)/float64(time.Millisecond), 'f', -1, 64)
+	}
+	return e
+}
+
+// DurBoth adds a duration to the logging event twice: once under key in the
+// same form as time.Duration.String, for people to read, and once as a number
+// of milliseconds under key with Logger.DurationSuffix appended, for queries.
+// For example, DurBoth("elapsed", 1500*time.Millisecond) logs elapsed=1.5s
+// elapsed_ms=1500. Binary loggers record the first as a time.Duration.
+func (e *Event) DurBoth(key string, d time.Duration) *Event {
+	if e == nil {
+		return e
+	}
+	e.appendKey(key)
+	e.enc.duration(e, d)
+	e.appendKeySuffix(key, e.durSuffix)
+	e.enc.float(e, float64(d)/float64(time.Millisecond), 'f', -1, 64)
+	return e
+}
+
+// Since adds the time elapsed since the logger's checkpoint with the name given
+// to the logging event, as name_since, written in the same form as
+// time.Duration.String. If there's no such checkpoint, the value is unknown.
+func (e *Event) Since(name string) *Event {
+	if e == nil {
+		return e
+	}
+	e.appendKeySuffix(name, "_since")
+	if t, ok := e.checkpoints.Load(name); ok {
+		e.enc.duration(e, time.Since(t.(time.Time)))
+	} else {
+		e.enc.str(e, "unknown")
+	}
+	return e
+}
+
+// Bytesize adds a size in bytes to the logging event twice: once under key in
+// binary (IEC) units with one decimal place, like 1.5KiB or 1.0GiB, for people
+// to read, and once as a number under key_bytes, for queries.
+func (e *Event) Bytesize(key string, bytes int64) *Event {
+	if e == nil {
+		return e
+	}
+	var buf [24]byte
+	e.appendKey(key)
+	e.enc.str(e, string(appendByteSize(buf[:0], bytes)))
+	e.appendKeySuffix(key, "_bytes")
+	e.enc.int(e, bytes)
+	return e
+}
+
+// AppendByteSize appends a number of bytes in IEC units.
+func appendByteSize(dst []byte, n int64) []byte {
+	const units = "KMGTPE"
+	if n < 1024 && n > -1024 {
+		dst = strconv.AppendInt(dst, n, 10)
+		return append(dst, 'B')
+	}
+	f := float64(n)
+	u := -1
+	for (f >= 1024 || f <= -1024) && u < len(units)-1 {
+		f /= 1024
+		u++
+	}
+	dst = strconv.AppendFloat(dst, f, 'f', 1, 64)
+	return append(dst, units[u], 'i', 'B')
+}
+
+// TimeDiff adds the end time of an interval to the logging event as key, and
+// the time elapsed since start as key_elapsed, written in the same form as
+// time.Duration.String.
+func (e *Event) TimeDiff(key string, end, start time.Time) *Event {
+	if e == nil {
+		return e
+	}
+	e.appendKey(key)
+	e.enc.time(e, end)
+	e.appendKeySuffix(key, "_elapsed")
+	e.enc.duration(e, end.Sub(start))
+	return e
+}
+
+// Object groups fields under a key. The function fn is called to add fields to
+// the event, and while it runs, their keys are prefixed with key and a dot. For
+// example:
+//
+//	l.Info().Object("req", func(e *blammo.Event) {
+//		e.Str("method", r.Method).Str("path", r.URL.Path)
+//	}).Msg("request")
+//
+// logs req.method and req.path. Objects can be nested. JSON loggers write a
+// nested JSON object instead, and as for Array, leave the whole object out if
+// MaxFields is reached inside it.
+func (e *Event) Object(key string, fn func(*Event)) *Event {
+	if e == nil {
+		return e
+	}
+	if _, ok := e.enc.(jsonEncoder); ok {
+		start := len(e.txt)
+		e.appendKey(key)
+		e.txt = append(e.txt, '{')
+		prefix := e.prefix
+		e.prefix = nil
+		fn(e)
+		e.prefix = prefix
+		e.txt = append(e.txt, '}')
+		if e.limitPos > start {
+			e.limitPos = start
+		}
+		return e
+	}
+	n := len(e.prefix)
+	e.prefix = append(e.prefix, key...)
+	e.prefix = append(e.prefix, '.')
+	fn(e)
+	e.prefix = e.prefix[:n]
+	return e
+}
+
+// ArrayCtx adds the elements of an array to a logging event. It's passed to
+// the function given to Event.Array.
+type ArrayCtx struct {
+	e      *Event
+	key    string
+	n      int
+	json   bool
+	prefix int
+}
+
+// Element starts the next element of the array, and returns the event for its
+// fields to be added to.
+func (a *ArrayCtx) Element() *Event {
+	e := a.e
+	if a.json {
+		if a.n > 0 {
+			e.txt = append(e.txt, '}', ',')
+		}
+		e.txt = append(e.txt, '{')
+	} else {
+		e.prefix = append(e.prefix[:a.prefix], a.key...)
+		e.prefix = append(e.prefix, '.')
+		e.prefix = strconv.AppendInt(e.prefix, int64(a.n), 10)
+		e.prefix = append(e.prefix, '.')
+	}
+	a.n++
+	return e
+}
+
+// Array adds a list of structured items to the logging event. The function
+// calls Element to start each item, then adds the item's fields to the event
+// returned. For example:
+//
+//	l.Info().Array("items", func(a *blammo.ArrayCtx) {
+//		for _, it := range items {
+//			a.Element().Str("name", it.Name).Int("id", it.ID)
+//		}
+//	}).Msg("order")
+//
+// logs items.0.name, items.0.id, items.1.name and so on. JSON loggers write a
+// real array of objects instead. If MaxFields is reached inside the array,
+// JSON loggers leave the whole array out, so that the output stays valid.
+func (e *Event) Array(key string, fn func(*ArrayCtx)) *Event {
+	if e == nil {
+		return e
+	}
+	a := &ArrayCtx{e: e, key: key, prefix: len(e.prefix)}
+	if _, ok := e.enc.(jsonEncoder); !ok {
+		fn(a)
+		e.prefix = e.prefix[:a.prefix]
+		return e
+	}
+	start := len(e.txt)
+	e.appendKey(key)
+	e.txt = append(e.txt, '[')
+	a.json = true
+	prefix := e.prefix
+	e.prefix = nil
+	fn(a)
+	e.prefix = prefix
+	if a.n > 0 {
+		e.txt = append(e.txt, '}')
+	}
+	e.txt = append(e.txt, ']')
+	if e.limitPos > start {
+		e.limitPos = start
 	}
-	e.txt = append(e.txt, tv...)
-	e.txt = append(e.txt, ' ')
 	return e
 }
 
+// RawField adds already formatted data to the logging event, followed by a
+// separator. The data is written exactly as provided, so it's up to the
+// caller to make sure it's a valid key=value fragment. It's intended for
+// adapters which receive fields pre-rendered by some other logging system.
+// Binary loggers record the data as a string field with an empty key.
+func (e *Event) RawField(data []byte) *Event {
+	if e == nil {
+		return e
+	}
+	e.enc.raw(e, data)
+	return e
+}
+
+// MemStats adds the current heap size, heap memory obtained from the OS,
+// number of completed GC cycles and number of goroutines to the logging event,
+// as @heap_alloc, @heap_sys, @num_gc and @goroutines.
+//
+// It calls runtime.ReadMemStats, which stops the world while it runs, so it's
+// intended for periodic health logging rather than anything frequent.
+func (e *Event) MemStats() *Event {
+	if e == nil {
+		return e
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return e.Uint64("@heap_alloc", ms.HeapAlloc).
+		Uint64("@heap_sys", ms.HeapSys).
+		Uint32("@num_gc", ms.NumGC).
+		Int("@goroutines", runtime.NumGoroutine())
+}
+
+// FileInfo adds the size, permissions and modification time of a file to the
+// logging event, as key.size, key.mode and key.mtime. If fi is nil, key is
+// logged as nil.
+func (e *Event) FileInfo(key string, fi os.FileInfo) *Event {
+	if e == nil {
+		return e
+	}
+	if fi == nil {
+		return e.Str(key, "nil")
+	}
+	return e.Int64(key+".size", fi.Size()).
+		Str(key+".mode", fi.Mode().String()).
+		Time(key+".mtime", fi.ModTime())
+}
+
+// AppendDecimal appends the decimal representation of units / 10^scale to a
+// byte slice. A negative scale appends trailing zeroes.
+func appendDecimal(dst []byte, units int64, scale int) []byte {
+	if scale <= 0 {
+		dst = strconv.AppendInt(dst, units, 10)
+		for ; units != 0 && scale < 0; scale++ {
+			dst = append(dst, '0')
+		}
+		return dst
+	}
+	u := uint64(units)
+	if units < 0 {
+		dst = append(dst, '-')
+		u = -u
+	}
+	start := len(dst)
+	dst = strconv.AppendUint(dst, u, 10)
+	// Pad with leading zeroes so there's at least one digit before the point
+	for len(dst)-start <= scale {
+		dst = append(dst, '0')
+		copy(dst[start+1:], dst[start:len(dst)-1])
+		dst[start] = '0'
+	}
+	// Then shuffle the fractional digits along and drop the point in
+	pt := len(dst) - scale
+	dst = append(dst, '.')
+	copy(dst[pt+1:], dst[pt:len(dst)-1])
+	dst[pt] = '.'
+	return dst
+}
+
+// AppendDuration appends a duration to a byte slice in the format used by
+// time.Duration.String, without allocating.
+func appendDuration(dst []byte, d time.Duration) []byte {
+	u := uint64(d)
+	if d < 0 {
+		dst = append(dst, '-')
+		u = -u
+	}
+	switch {
+	case u == 0:
+		return append(dst, "0s"...)
+	case u < uint64(time.Microsecond):
+		dst = strconv.AppendUint(dst, u, 10)
+		return append(dst, "ns"...)
+	case u < uint64(time.Millisecond):
+		dst = appendFraction(dst, u, 3)
+		return append(dst, "µs"...)
+	case u < uint64(time.Second):
+		dst = appendFraction(dst, u, 6)
+		return append(dst, "ms"...)
+	}
+	h := u / uint64(time.Hour)
+	u -= h * uint64(time.Hour)
+	m := u / uint64(time.Minute)
+	u -= m * uint64(time.Minute)
+	if h > 0 {
+		dst = strconv.AppendUint(dst, h, 10)
+		dst = append(dst, 'h')
+	}
+	if h > 0 || m > 0 {
+		dst = strconv.AppendUint(dst, m, 10)
+		dst = append(dst, 'm')
+	}
+	dst = appendFraction(dst, u, 9)
+	return append(dst, 's')
+}
+
+// AppendFraction appends v / 10^prec to a byte slice, leaving out trailing
+// zeroes after the point, and the point itself if there's nothing after it.
+func appendFraction(dst []byte, v uint64, prec int) []byte {
+	pow := uint64(1)
+	for i := 0; i < prec; i++ {
+		pow *= 10
+	}
+	dst = strconv.AppendUint(dst, v/pow, 10)
+	frac := v % pow
+	if frac == 0 {
+		return dst
+	}
+	for frac%10 == 0 {
+		frac /= 10
+		prec--
+	}
+	dst = append(dst, '.')
+	start := len(dst)
+	dst = strconv.AppendUint(dst, frac, 10)
+	for len(dst)-start < prec {
+		dst = append(dst, '0')
+		copy(dst[start+1:], dst[start:len(dst)-1])
+		dst[start] = '0'
+	}
+	return dst
+}
+
 // Abbreviate chops off all but the last two pieces of a file path.
 // e.g. /home/user/go/src/github.com/username/project/model/foo.go becomes model/foo.go
 func abbreviate(path string) string {
@@ -425,42 +1647,145 @@ func abbreviate(path string) string {
 	return path[ps:]
 }
 
-func (e *Event) writeCallStack(maxlevels int) *Event {
-	if maxlevels == 0 {
-		return e
-	}
-  goroot := runtime.GOROOT()
-  n := 0
-  fn := ""
-  line := 0
-	ok := true
-	lvl := '0'
-	walo := false
-	for ok && n < maxlevels {
-		_, fn, line, ok = runtime.Caller(n+blammoLevels)
-		if ok {
-			if e.withSystem || !strings.HasPrefix(fn, goroot) {
-				e.Str("@file_"+string(lvl), abbreviate(fn))
-				e.Int("@line_"+string(lvl), line)
-				lvl++
-				walo = true
-			}
+// SourcePath shortens the path of a source file for logging, by removing the
+// logger's TrimPath prefix if it has one, or by abbreviating it otherwise.
+func (e *Event) sourcePath(fn string) string {
+	if e.trimPath != "" && strings.HasPrefix(fn, e.trimPath) {
+		return strings.TrimLeft(fn[len(e.trimPath):], "/")
+	}
+	return abbreviate(fn)
+}
+
+// Keys for the first few levels of call stack, so they needn't be built each time.
+var fileKeys = [...]string{"@file_0", "@file_1", "@file_2", "@file_3", "@file_4",
+	"@file_5", "@file_6", "@file_7", "@file_8", "@file_9"}
+var lineKeys = [...]string{"@line_0", "@line_1", "@line_2", "@line_3", "@line_4",
+	"@line_5", "@line_6", "@line_7", "@line_8", "@line_9"}
+
+// callerInfo is the source location of a program counter.
+type callerInfo struct {
+	file     string
+	line     int
+	function string
+}
+
+// Looking up source locations is slow, so they're cached by program counter.
+// There's a fixed number of call sites in a program, so the cache is bounded.
+var callerCache = struct {
+	sync.RWMutex
+	m map[uintptr]callerInfo
+}{m: make(map[uintptr]callerInfo)}
+
+// CallerAt returns the source location of a program counter returned by
+// runtime.Callers.
+func callerAt(pc uintptr) callerInfo {
+	callerCache.RLock()
+	ci, ok := callerCache.m[pc]
+	callerCache.RUnlock()
+	if ok {
+		return ci
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	ci = callerInfo{frame.File, frame.Line, frame.Function}
+	callerCache.Lock()
+	callerCache.m[pc] = ci
+	callerCache.Unlock()
+	return ci
+}
+
+func (e *Event) writeCallStack(skip int, maxlevels int) *Event {
+	e.stack = false
+	e.autoCaller = false
+	if maxlevels == 0 || e.noCaller {
+		return e
+	}
+	var buf [16]uintptr
+	pcs := buf[:]
+	if maxlevels > len(pcs) {
+		pcs = make([]uintptr, maxlevels)
+	}
+	// Callers counts itself as a level, where Caller doesn't
+	pcs = pcs[:runtime.Callers(skip+1, pcs[:maxlevels])]
+	goroot := runtime.GOROOT()
+	lvl := 0
+	for _, pc := range pcs {
+		ci := callerAt(pc)
+		if e.withSystem || !strings.HasPrefix(ci.file, goroot) {
+			e.writeFrame(lvl, ci)
+			lvl++
 		}
-		n++
 	}
-	if !walo {
+	if lvl == 0 {
 		e.Str("@file_0", "unavailable")
 	}
 	return e
 }
 
+// WriteFrame writes the file and line of one level of call stack. Synthetic
+// frames can have no file or line, in which case those keys are left out
+// rather than written with meaningless values.
+func (e *Event) writeFrame(lvl int, ci callerInfo) {
+	var fileKey, lineKey string
+	if lvl < len(fileKeys) {
+		fileKey, lineKey = fileKeys[lvl], lineKeys[lvl]
+	} else {
+		n := strconv.Itoa(lvl)
+		fileKey, lineKey = "@file_"+n, "@line_"+n
+	}
+	if ci.file != "" {
+		e.Str(fileKey, e.sourcePath(ci.file))
+	}
+	if ci.line != 0 {
+		e.Int(lineKey, ci.line)
+	}
+}
+
+// SentryStack writes a call stack in the order error trackers such as Sentry
+// expect, with the most recent call last, as @frame_0.file, @frame_0.line and
+// @frame_0.function for the outermost call, up to @frame_n for the current
+// line. The number of levels written is limited by Logger.MaxCallLevels.
+func (e *Event) SentryStack() *Event {
+	if e == nil {
+		return e
+	}
+	e.stack = false
+	e.autoCaller = false
+	if e.callLevels == 0 || e.noCaller {
+		return e
+	}
+	var buf [16]uintptr
+	pcs := buf[:]
+	if e.callLevels > len(pcs) {
+		pcs = make([]uintptr, e.callLevels)
+	}
+	// Skip Callers and SentryStack
+	pcs = pcs[:runtime.Callers(2, pcs[:e.callLevels])]
+	goroot := runtime.GOROOT()
+	frames := make([]callerInfo, 0, len(pcs))
+	for _, pc := range pcs {
+		ci := callerAt(pc)
+		if e.withSystem || !strings.HasPrefix(ci.file, goroot) {
+			frames = append(frames, ci)
+		}
+	}
+	for i := range frames {
+		ci := frames[len(frames)-1-i]
+		e.Object("@frame_"+strconv.Itoa(i), func(e *Event) {
+			e.Str("file", e.sourcePath(ci.file)).
+				Int("line", ci.line).
+				Str("function", ci.function)
+		})
+	}
+	return e
+}
+
 // Line writes the current line number and file of the source code as the
 // @line_0 and @file_0 keys.
 func (e *Event) Line() *Event {
 	if e == nil {
 		return e
 	}
-	return e.writeCallStack(1)
+	return e.writeCallStack(blammoLevels, 1)
 }
 
 // Caller writes the line number and file of the source code that the current
@@ -470,7 +1795,7 @@ func (e *Event) Caller() *Event {
 	if e == nil {
 		return e
 	}
-	return e.writeCallStack(2)
+	return e.writeCallStack(blammoLevels, 2)
 }
 
 // CallStack() writes a call stack as @file_0..@file_n and @line_0..@line_n.
@@ -479,20 +1804,170 @@ func (e *Event) CallStack() *Event {
 	if e == nil {
 		return e
 	}
-	return e.writeCallStack(e.callLevels)
+	return e.writeCallStack(blammoLevels, e.callLevels)
+}
+
+// CallStackN writes a call stack of n levels as @file_0..@file_n and
+// @line_0..@line_n, whatever the value of Logger.MaxCallLevels.
+func (e *Event) CallStackN(n int) *Event {
+	if e == nil {
+		return e
+	}
+	return e.writeCallStack(blammoLevels, n)
+}
+
+// CallerSkip makes the call stack or caller written when the event is sent,
+// as set by StackMinLevel and CallerLevels, skip another n levels. It's for
+// wrappers which send events on behalf of their callers, so that the stack
+// starts at the wrapper's caller rather than the wrapper.
+func (e *Event) CallerSkip(n int) *Event {
+	if e == nil {
+		return e
+	}
+	e.skip += n
+	return e
 }
 
 // Msg writes the accumulated log entry to the log, along with the
-// message provided.
+// message provided. Each event is passed to the writer as a single complete
+// line in one call to Write, so a writer which makes one write(2) per call
+// never splits a line; writers such as BufferedWriter and Batch may still
+// combine lines.
 func (e *Event) Msg(msg string) {
 	if e == nil {
 		return
 	}
-	bsx := []byte(msg + " ")
-	e.txt = splice(e.txt, bsx, e.msgpos)
-	e.txt[len(e.txt)-1] = '\n'
-	e.out.Write(e.txt)
+	e.send(msg)
+}
+
+// MsgDeferred returns a function which writes the event with the message it's
+// given, so that the message can be supplied later, for example by defer:
+//
+//	done := l.Info().Str("op", op).MsgDeferred()
+//	defer done("completed")
+//
+// The function must be called exactly once.
+func (e *Event) MsgDeferred() func(msg string) {
+	if e == nil {
+		return func(string) {}
+	}
+	return func(msg string) {
+		e.send(msg)
+	}
+}
+
+// Write adds p to the event's message, so that the event can be used as an
+// io.Writer, for example with fmt.Fprintf. The text written comes before any
+// message passed to Msg. Write always succeeds.
+func (e *Event) Write(p []byte) (int, error) {
+	if e == nil {
+		return len(p), nil
+	}
+	e.msgBuf = append(e.msgBuf, p...)
+	return len(p), nil
+}
+
+// Send writes the accumulated log entry to the log, with the message built up
+// by calls to Write.
+func (e *Event) Send() {
+	if e == nil {
+		return
+	}
+	e.send("")
+}
+
+// MsgRaw is like Msg, but for relaying pre-formatted text which may already
+// end with a newline, such as lines read from another process. In the text
+// formats the text is written as it is at the end of the line, after any
+// fields, with no space added before it and a newline added only if it
+// doesn't already end with one. Other formats need the message in a field of
+// their own, so a trailing newline or CRLF is removed and it's written as for
+// Msg.
+func (e *Event) MsgRaw(msg string) {
+	if e == nil {
+		return
+	}
+	if _, ok := e.enc.(textEncoder); ok {
+		e.rawMsg = true
+	} else {
+		msg = strings.TrimSuffix(msg, "\n")
+		msg = strings.TrimSuffix(msg, "\r")
+	}
+	e.send(msg)
+}
+
+// Send writes the event with the message supplied, and returns any error from
+// the writer.
+func (e *Event) send(msg string) error {
+	e.finish(msg)
+	err := e.write(nil)
 	eventPool.Put(e)
+	return err
+}
+
+// ErrEventTooLarge is the error passed to Logger.ErrorHandler for an event
+// which is larger than Logger.MaxWriteSize.
+var ErrEventTooLarge = errors.New("log event larger than maximum write size")
+
+// Write writes the finished event to its writer in a single call, unless it's
+// larger than MaxWriteSize, and passes any error to the error handler. If ctx
+// isn't nil and the writer is a ContextWriter, ctx is passed to it. The write
+// holds the logger's read lock, so that Reopen can wait for it, and goes to
+// the new writer if Reopen has been called since the event was created.
+func (e *Event) write(ctx context.Context) error {
+	var err error
+	e.owner.wmu.RLock()
+	if e.src != nil && e.gen != e.owner.reopens {
+		e.out = *e.src
+	}
+	cw, ok := e.out.(ContextWriter)
+	switch {
+	case e.out == nil:
+		// Reopen switched the level off
+	case e.maxWrite > 0 && len(e.txt) > e.maxWrite:
+		err = fmt.Errorf("%w: %d bytes, limit %d", ErrEventTooLarge, len(e.txt), e.maxWrite)
+	case ok && ctx != nil:
+		_, err = cw.WriteContext(ctx, e.txt)
+	default:
+		_, err = e.out.Write(e.txt)
+	}
+	e.owner.wmu.RUnlock()
+	if err != nil && e.errHandler != nil {
+		e.errHandler(err)
+	}
+	return err
+}
+
+// Finish completes the event with the message supplied, ready to be written.
+// The call stack or caller is written first if the event's level calls for it
+// and it hasn't been written already, skipping Finish itself, the send method
+// which called it, and the Msg or Msgf method which called that. The completed
+// event is then passed to any error hook.
+func (e *Event) finish(msg string) {
+	if len(e.msgBuf) > 0 {
+		msg = string(e.msgBuf) + msg
+	}
+	if e.limitPos > 0 {
+		e.txt = e.txt[:e.limitPos]
+		e.maxFields = 0
+		e.Bool("@fields_truncated", true)
+	}
+	if e.clamped {
+		e.clamped = false
+		e.Bool("@clamped", true)
+	}
+	if e.stack {
+		e.writeCallStack(blammoLevels+1+e.skip, e.callLevels)
+	} else if e.autoCaller {
+		e.writeCallStack(blammoLevels+1+e.skip, 2)
+	}
+	e.enc.end(e, msg)
+	if e.hookErr != nil {
+		if e.errHook != nil && e.level == ErrorLevel {
+			e.errHook(e.hookErr, e.txt)
+		}
+		e.hookErr = nil
+	}
 }
 
 // Msgf writes a message formatted as per fmt.Sprintf. It's likely to be slower
@@ -502,5 +1977,5 @@ func (e *Event) Msgf(fmtstr string, vals ...interface{}) {
 		return
 	}
 	msg := fmt.Sprintf(fmtstr, vals...)
-	e.Msg(msg)
+	e.send(msg)
 }
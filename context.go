@@ -0,0 +1,102 @@
+package blammo
+
+import (
+	"context"
+	"errors"
+)
+
+type contextKey struct{}
+
+// ctxField is a key and value stored in a context by AddField.
+type ctxField struct {
+	key   string
+	value string
+}
+
+// AddField returns a copy of ctx which carries an extra key and value to be
+// added to log events by Ctx. Fields accumulate as the context is passed down,
+// so each piece of middleware can add its own. Adding a key which is already
+// present replaces its value.
+func AddField(ctx context.Context, key, value string) context.Context {
+	old, _ := ctx.Value(contextKey{}).([]ctxField)
+	fields := make([]ctxField, 0, len(old)+1)
+	for _, f := range old {
+		if f.key != key {
+			fields = append(fields, f)
+		}
+	}
+	fields = append(fields, ctxField{key, value})
+	return context.WithValue(ctx, contextKey{}, fields)
+}
+
+// ContextFields returns the fields which have been added to ctx by AddField,
+// or nil if there aren't any.
+func ContextFields(ctx context.Context) map[string]string {
+	fields, _ := ctx.Value(contextKey{}).([]ctxField)
+	if len(fields) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(fields))
+	for _, f := range fields {
+		m[f.key] = f.value
+	}
+	return m
+}
+
+// Ctx adds the fields stored in ctx by AddField to the logging event, in the
+// order they were added.
+func (e *Event) Ctx(ctx context.Context) *Event {
+	if e == nil {
+		return e
+	}
+	fields, _ := ctx.Value(contextKey{}).([]ctxField)
+	for _, f := range fields {
+		e.Str(f.key, f.value)
+	}
+	return e
+}
+
+// ErrCtx adds an error as Err does, and also @cancelled=true if ctx was
+// cancelled or the error is context.Canceled, or @timeout=true if ctx's
+// deadline passed or the error is context.DeadlineExceeded. It lets failures
+// caused by clients going away be told apart from real errors.
+func (e *Event) ErrCtx(ctx context.Context, err error) *Event {
+	if e == nil {
+		return e
+	}
+	e.Err(err)
+	cerr := ctx.Err()
+	switch {
+	case cerr == context.Canceled || errors.Is(err, context.Canceled):
+		e.Bool("@cancelled", true)
+	case cerr == context.DeadlineExceeded || errors.Is(err, context.DeadlineExceeded):
+		e.Bool("@timeout", true)
+	}
+	return e
+}
+
+// ContextWriter is implemented by writers which can give up on a write when a
+// context is cancelled or its deadline passes, such as writers to network
+// sinks.
+type ContextWriter interface {
+	WriteContext(ctx context.Context, p []byte) (int, error)
+}
+
+// MsgCtx writes the accumulated log entry to the log, along with the message
+// provided, and returns any error from the writer. If the writer is a
+// ContextWriter, ctx is passed to it so that the write can be abandoned when
+// ctx is done; otherwise the write is the same as for Msg.
+func (e *Event) MsgCtx(ctx context.Context, msg string) error {
+	if e == nil {
+		return nil
+	}
+	return e.sendCtx(ctx, msg)
+}
+
+// SendCtx is send with a context for the write.
+func (e *Event) sendCtx(ctx context.Context, msg string) error {
+	e.finish(msg)
+	err := e.write(ctx)
+	eventPool.Put(e)
+	return err
+}
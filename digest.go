@@ -0,0 +1,169 @@
+package blammo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DigestWriter is an io.Writer which stops floods of identical log lines from
+// burying everything else. The first time a line is seen in each time window,
+// it's passed straight through to the inner writer. Repeats are counted instead
+// of written, and at the end of the window a digest line is written for each
+// line which was repeated: the last copy of the line, with @suppressed and
+// @window fields added to say how many copies were left out.
+//
+// It understands blammo's text and JSON formats, adding the fields to a JSON
+// line as members of its object. Binary records are rejected with
+// ErrDigestBinary, as they can't be compared or extended as lines.
+//
+// Each call to Write is treated as a single line, which is how Logger writes.
+// Batch doesn't, so batched output mustn't go through a DigestWriter.
+type DigestWriter struct {
+	// Key returns the text used to decide whether two lines are the same. The
+	// default skips the timestamp: for text lines, it uses everything from the
+	// first '[' onwards, and for JSON lines, everything from the "level" key
+	// onwards. Set it before logging.
+	Key func(line []byte) string
+
+	mu     sync.Mutex
+	inner  io.Writer
+	window time.Duration
+	seen   map[string]*digestEntry
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+type digestEntry struct {
+	last       []byte
+	suppressed int
+}
+
+// ErrDigestBinary is returned by DigestWriter for binary records.
+var ErrDigestBinary = errors.New("DigestWriter can't digest binary log records")
+
+// DefaultDigestWindow is the window a DigestWriter uses if it isn't given one.
+const DefaultDigestWindow = time.Minute
+
+// NewDigestWriter creates a DigestWriter which writes to inner, and reports
+// repeated lines every window. A window of zero or less means
+// DefaultDigestWindow. Call Close to stop it.
+func NewDigestWriter(inner io.Writer, window time.Duration) *DigestWriter {
+	if window <= 0 {
+		window = DefaultDigestWindow
+	}
+	w := &DigestWriter{
+		Key:    digestKey,
+		inner:  inner,
+		window: window,
+		seen:   make(map[string]*digestEntry),
+		done:   make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+func digestKey(line []byte) string {
+	if isJSONLine(line) {
+		if i := bytes.Index(line, []byte(`"level"`)); i > 0 {
+			line = line[i:]
+		}
+	} else if i := bytes.IndexByte(line, '['); i > 0 {
+		line = line[i:]
+	}
+	return string(line)
+}
+
+// IsJSONLine reports whether a line is a JSON object, as written by the NDJSON
+// and console JSON loggers.
+func isJSONLine(line []byte) bool {
+	return len(line) > 0 && line[0] == '{'
+}
+
+// IsBinaryRecord reports whether p is a record in the binary format, whose
+// length prefix covers the rest of it. Text can't match, as the prefix would
+// be four printable characters.
+func isBinaryRecord(p []byte) bool {
+	return len(p) >= 4 && binary.BigEndian.Uint32(p) == uint32(len(p)-4)
+}
+
+func (w *DigestWriter) run() {
+	defer w.wg.Done()
+	t := time.NewTicker(w.window)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			w.flush()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Write passes the line through if it's the first of its kind in the current
+// window, and counts it otherwise.
+func (w *DigestWriter) Write(p []byte) (int, error) {
+	if isBinaryRecord(p) {
+		return 0, ErrDigestBinary
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k := w.Key(p)
+	if ent, ok := w.seen[k]; ok {
+		ent.last = append(ent.last[:0], p...)
+		ent.suppressed++
+		return len(p), nil
+	}
+	w.seen[k] = &digestEntry{}
+	return w.inner.Write(p)
+}
+
+// Flush writes digest lines for anything repeated in the window just ended,
+// and starts a new window.
+func (w *DigestWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for k, ent := range w.seen {
+		delete(w.seen, k)
+		if ent.suppressed == 0 {
+			continue
+		}
+		w.inner.Write(w.digestLine(ent))
+	}
+}
+
+// DigestLine returns the last copy of a repeated line with the @suppressed and
+// @window fields added.
+func (w *DigestWriter) digestLine(ent *digestEntry) []byte {
+	line := bytes.TrimRight(ent.last, "\n")
+	if isJSONLine(line) && line[len(line)-1] == '}' {
+		line = line[:len(line)-1]
+		line = append(line, `,"@suppressed":`...)
+		line = strconv.AppendInt(line, int64(ent.suppressed), 10)
+		line = append(line, `,"@window":"`...)
+		line = append(line, w.window.String()...)
+		line = append(line, '"', '}', '\n')
+		return line
+	}
+	line = append(line, " @suppressed="...)
+	line = strconv.AppendInt(line, int64(ent.suppressed), 10)
+	line = append(line, " @window="...)
+	line = append(line, w.window.String()...)
+	line = append(line, '\n')
+	return line
+}
+
+// Close stops the timer, and writes digests for any lines repeated since the
+// last window ended. It doesn't close the inner writer.
+func (w *DigestWriter) Close() error {
+	close(w.done)
+	w.wg.Wait()
+	w.flush()
+	return nil
+}
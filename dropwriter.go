@@ -0,0 +1,102 @@
+package blammo
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// DropWriter is an io.Writer which hands lines to a background goroutine to be
+// written, through a bounded queue. If the queue is full, the line is thrown
+// away rather than making the caller wait, and counted. It's meant for debug
+// output in production, where losing lines is better than adding latency:
+//
+//	l.DebugWriter = blammo.NewDropWriter(sink, 1024)
+//
+// Each call to Write is queued as a unit, which is how Logger writes. The lines
+// flushed from a Batch would be queued and dropped together, so a Batch
+// mustn't write to a DropWriter.
+type DropWriter struct {
+	dropped uint64 // accessed atomically; first for alignment
+
+	inner io.Writer
+	queue chan *[]byte
+	wg    sync.WaitGroup
+}
+
+var dropBufPool = &sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, bufferSize)
+		return &b
+	},
+}
+
+// NewDropWriter creates a DropWriter which writes to inner, and queues up to
+// size lines. Call Close to stop it.
+func NewDropWriter(inner io.Writer, size int) *DropWriter {
+	w := &DropWriter{
+		inner: inner,
+		queue: make(chan *[]byte, size),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+func (w *DropWriter) run() {
+	defer w.wg.Done()
+	for b := range w.queue {
+		w.inner.Write(*b)
+		*b = (*b)[:0]
+		dropBufPool.Put(b)
+	}
+}
+
+// Write queues a copy of p to be written, or drops it if the queue is full. It
+// never blocks, and always reports success.
+func (w *DropWriter) Write(p []byte) (int, error) {
+	b := dropBufPool.Get().(*[]byte)
+	*b = append(*b, p...)
+	select {
+	case w.queue <- b:
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+		*b = (*b)[:0]
+		dropBufPool.Put(b)
+	}
+	return len(p), nil
+}
+
+// Dropped returns how many lines have been thrown away because the queue was
+// full.
+func (w *DropWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Close waits for the queued lines to be written, then stops the background
+// goroutine. It doesn't close the inner writer. The DropWriter mustn't be
+// written to after it's closed.
+func (w *DropWriter) Close() error {
+	close(w.queue)
+	w.wg.Wait()
+	return nil
+}
+
+// NewPipeSafeLogger creates a logger like NewPipeLogger, except that stdout
+// and stderr are written through DropWriters which queue up to size lines
+// each. If the process reading the pipe stops, lines are dropped rather than
+// stalling the caller once the queue fills. Close the logger to flush the
+// queues, which will wait if the reader is still stalled.
+func NewPipeSafeLogger(size int) *Logger {
+	l := NewPipeLogger()
+	ew := NewDropWriter(os.Stderr, size)
+	iw := NewDropWriter(os.Stdout, size)
+	l.ErrorWriter = ew
+	l.InfoWriter = iw
+	l.Closer = func() {
+		ew.Close()
+		iw.Close()
+	}
+	return l
+}
@@ -0,0 +1,303 @@
+package blammo
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// encoder renders the parts of a logging event into the event's buffer. Each
+// value method is called straight after key, and must write whatever separator
+// its format needs between fields. The key is written with the suffix given
+// appended, which saves callers building compound keys.
+type encoder interface {
+	begin(e *Event, l *Logger, level Level, tag []byte)
+	key(e *Event, key string, suffix string)
+	str(e *Event, s string)
+	int(e *Event, i int64)
+	uint(e *Event, u uint64)
+	float(e *Event, f float64, fmt byte, prec int, bitSize int)
+	bool(e *Event, b bool)
+	time(e *Event, t time.Time)
+	duration(e *Event, d time.Duration)
+	bytes(e *Event, b []byte)
+	decimal(e *Event, units int64, scale int)
+	raw(e *Event, data []byte)
+	end(e *Event, msg string)
+}
+
+// textEncoder writes the human readable text format: an optional timestamp,
+// the level tag, the message, then key=value pairs separated by spaces.
+type textEncoder struct{}
+
+func (textEncoder) begin(e *Event, l *Logger, level Level, tag []byte) {
+	if !l.TimestampAfterTag {
+		appendTimestamp(e, l, level)
+	}
+	if l.NumericLevels {
+		e.appendKey("@severity")
+		e.txt = strconv.AppendInt(e.txt, int64(severity(level)), 10)
+		e.txt = append(e.txt, ' ')
+	} else {
+		e.txt = append(e.txt, tag...)
+	}
+	if l.TimestampAfterTag {
+		appendTimestamp(e, l, level)
+	}
+}
+
+// AppendTimestamp writes the timestamp of a text event, if its level has one.
+func appendTimestamp(e *Event, l *Logger, level Level) {
+	if l.TimestampLevels != 0 && !l.TimestampLevels.Has(level) && level != AuditLevel {
+		return
+	}
+	if l.TimestampFunc != nil {
+		e.txt = l.TimestampFunc(e.txt, time.Now())
+	} else if l.Timestamp == timestampFormat {
+		e.txt = appendSecondTimestamp(e.txt, time.Now(), l.UTC)
+	} else if l.Timestamp != "" {
+		if l.UTC {
+			e.txt = time.Now().UTC().AppendFormat(e.txt, l.Timestamp)
+		} else {
+			e.txt = time.Now().AppendFormat(e.txt, l.Timestamp)
+		}
+	} else if level == AuditLevel {
+		e.txt = time.Now().UTC().AppendFormat(e.txt, time.RFC3339+" ")
+	}
+}
+
+// cachedTimestamp is a timestamp formatted to the second.
+type cachedTimestamp struct {
+	sec  int64
+	text []byte
+}
+
+// The last timestamps written in the default format, in local time and UTC.
+// At high log rates most events fall in the same second as the one before.
+var timestampCache [2]atomic.Value
+
+// AppendSecondTimestamp appends t in the default timestamp format, reusing the
+// formatted text if it's in the same second as the last one.
+func appendSecondTimestamp(dst []byte, t time.Time, utc bool) []byte {
+	i := 0
+	if utc {
+		i = 1
+		t = t.UTC()
+	}
+	sec := t.Unix()
+	if c, ok := timestampCache[i].Load().(*cachedTimestamp); ok && c.sec == sec {
+		return append(dst, c.text...)
+	}
+	c := &cachedTimestamp{sec: sec, text: t.AppendFormat(nil, timestampFormat)}
+	timestampCache[i].Store(c)
+	return append(dst, c.text...)
+}
+
+func (textEncoder) key(e *Event, key string, suffix string) {
+	e.txt = append(e.txt, e.keyStart...)
+	e.txt = append(e.txt, key...)
+	e.txt = append(e.txt, suffix...)
+	e.txt = append(e.txt, e.keyEnd...)
+	e.txt = append(e.txt, '=')
+}
+
+func (textEncoder) str(e *Event, s string) {
+	e.txt = append(e.txt, s...)
+	e.txt = append(e.txt, ' ')
+}
+
+func (textEncoder) int(e *Event, i int64) {
+	e.txt = strconv.AppendInt(e.txt, i, 10)
+	e.txt = append(e.txt, ' ')
+}
+
+func (textEncoder) uint(e *Event, u uint64) {
+	e.txt = strconv.AppendUint(e.txt, u, 10)
+	e.txt = append(e.txt, ' ')
+}
+
+func (textEncoder) float(e *Event, f float64, fmt byte, prec int, bitSize int) {
+	e.txt = appendFloat(e.txt, f, fmt, prec, bitSize, e.nonFinite)
+	e.txt = append(e.txt, ' ')
+}
+
+// AppendFloat appends a float as per strconv.AppendFloat, except that NaN and
+// infinite values are written according to nf.
+func appendFloat(dst []byte, f float64, fmt byte, prec int, bitSize int, nf NonFiniteFormat) []byte {
+	if nf == NonFiniteBare || !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return strconv.AppendFloat(dst, f, fmt, prec, bitSize)
+	}
+	if nf == NonFiniteNull {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '"')
+	dst = strconv.AppendFloat(dst, f, fmt, prec, bitSize)
+	return append(dst, '"')
+}
+
+func (textEncoder) bool(e *Event, b bool) {
+	switch {
+	case e.boolFmt == OneZero && b:
+		e.txt = append(e.txt, '1')
+	case e.boolFmt == OneZero:
+		e.txt = append(e.txt, '0')
+	case e.boolFmt == YesNo && b:
+		e.txt = append(e.txt, "yes"...)
+	case e.boolFmt == YesNo:
+		e.txt = append(e.txt, "no"...)
+	default:
+		e.txt = strconv.AppendBool(e.txt, b)
+	}
+	e.txt = append(e.txt, ' ')
+}
+
+// Times are written in the same RFC 3339 format as time.Time.MarshalText, but
+// without allocating.
+func (textEncoder) time(e *Event, t time.Time) {
+	e.txt = t.AppendFormat(e.txt, time.RFC3339Nano)
+	e.txt = append(e.txt, ' ')
+}
+
+func (textEncoder) duration(e *Event, d time.Duration) {
+	e.txt = appendDuration(e.txt, d)
+	e.txt = append(e.txt, ' ')
+}
+
+func (textEncoder) bytes(e *Event, b []byte) {
+	n := len(e.txt)
+	e.txt = append(e.txt, make([]byte, hex.EncodedLen(len(b)))...)
+	hex.Encode(e.txt[n:], b)
+	e.txt = append(e.txt, ' ')
+}
+
+func (textEncoder) decimal(e *Event, units int64, scale int) {
+	e.txt = appendDecimal(e.txt, units, scale)
+	e.txt = append(e.txt, ' ')
+}
+
+func (textEncoder) raw(e *Event, data []byte) {
+	e.txt = append(e.txt, data...)
+	e.txt = append(e.txt, ' ')
+}
+
+// End splices the message in after the level tag, or appends it if FastMsg is
+// set, and replaces the trailing separator with a newline. Messages from
+// MsgRaw are appended as they are.
+func (textEncoder) end(e *Event, msg string) {
+	if e.rawMsg {
+		e.txt = append(e.txt, msg...)
+		if msg == "" || msg[len(msg)-1] != '\n' {
+			e.txt = append(e.txt, '\n')
+		}
+		return
+	}
+	if e.fastMsg {
+		if msg != "" {
+			e.txt = append(e.txt, msg...)
+			e.txt = append(e.txt, ' ')
+		}
+		// The line can be empty, or end without a separator if TimestampFunc
+		// wrote one without
+		if n := len(e.txt); n > 0 && e.txt[n-1] == ' ' {
+			e.txt[n-1] = '\n'
+		} else {
+			e.txt = append(e.txt, '\n')
+		}
+		return
+	}
+	bsx := []byte(msg + " ")
+	e.txt = splice(e.txt, bsx, e.msgpos)
+	e.txt[len(e.txt)-1] = '\n'
+}
+
+// Encoder is implemented by types which render logging events in a format of
+// their own, for use as Logger.Encoder. Each method appends to the event's
+// buffer dst and returns the extended buffer, in the manner of the strconv
+// Append functions, so encoders don't need to allocate.
+//
+// Begin is called first, with the event's level, the logger's tag for the
+// level, and the time. Each field is then written by a call to AppendKey
+// followed by one of the value methods, which should write any separator the
+// format needs. Finally End is called with the message, and the position in
+// dst where Begin finished, so that the message can be put there if the format
+// needs it before the fields. Whatever End returns is written to the log.
+//
+// An Encoder may be called from several goroutines at once, so any state it
+// keeps must be safe for concurrent use.
+type Encoder interface {
+	Begin(dst []byte, level Level, tag []byte, t time.Time) []byte
+	AppendKey(dst []byte, key string) []byte
+	AppendString(dst []byte, s string) []byte
+	AppendInt(dst []byte, i int64) []byte
+	AppendUint(dst []byte, u uint64) []byte
+	AppendFloat(dst []byte, f float64, fmt byte, prec int, bitSize int) []byte
+	AppendBool(dst []byte, b bool) []byte
+	AppendTime(dst []byte, t time.Time) []byte
+	AppendDuration(dst []byte, d time.Duration) []byte
+	AppendBytes(dst []byte, b []byte) []byte
+	AppendRaw(dst []byte, data []byte) []byte
+	End(dst []byte, msgpos int, msg string) []byte
+}
+
+// customEncoder passes the parts of an event to the event's Logger.Encoder.
+// Decimals are passed as strings, so they stay exact, and compound keys are
+// joined before they're passed on.
+type customEncoder struct{}
+
+func (customEncoder) begin(e *Event, l *Logger, level Level, tag []byte) {
+	e.txt = e.custom.Begin(e.txt, level, tag, time.Now())
+}
+
+func (customEncoder) key(e *Event, key string, suffix string) {
+	if suffix != "" {
+		key += suffix
+	}
+	e.txt = e.custom.AppendKey(e.txt, key)
+}
+
+func (customEncoder) str(e *Event, s string) {
+	e.txt = e.custom.AppendString(e.txt, s)
+}
+
+func (customEncoder) int(e *Event, i int64) {
+	e.txt = e.custom.AppendInt(e.txt, i)
+}
+
+func (customEncoder) uint(e *Event, u uint64) {
+	e.txt = e.custom.AppendUint(e.txt, u)
+}
+
+func (customEncoder) float(e *Event, f float64, fmt byte, prec int, bitSize int) {
+	e.txt = e.custom.AppendFloat(e.txt, f, fmt, prec, bitSize)
+}
+
+func (customEncoder) bool(e *Event, b bool) {
+	e.txt = e.custom.AppendBool(e.txt, b)
+}
+
+func (customEncoder) time(e *Event, t time.Time) {
+	e.txt = e.custom.AppendTime(e.txt, t)
+}
+
+func (customEncoder) duration(e *Event, d time.Duration) {
+	e.txt = e.custom.AppendDuration(e.txt, d)
+}
+
+func (customEncoder) bytes(e *Event, b []byte) {
+	e.txt = e.custom.AppendBytes(e.txt, b)
+}
+
+func (customEncoder) decimal(e *Event, units int64, scale int) {
+	var buf [24]byte
+	e.txt = e.custom.AppendString(e.txt, string(appendDecimal(buf[:0], units, scale)))
+}
+
+func (customEncoder) raw(e *Event, data []byte) {
+	e.txt = e.custom.AppendRaw(e.txt, data)
+}
+
+func (customEncoder) end(e *Event, msg string) {
+	e.txt = e.custom.End(e.txt, e.msgpos, msg)
+}
@@ -0,0 +1,55 @@
+package blammo
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// NewLoggerFromEnv creates a new logger configured by environment variables,
+// for twelve-factor apps:
+//
+//	BLAMMO_FORMAT     console, pipe (or logfmt), cloud, json (or ndjson) or binary
+//	BLAMMO_LEVEL      debug, info, warn or error; the lowest level logged
+//	BLAMMO_UTC        true to write timestamps in UTC
+//	BLAMMO_TIMESTAMP  a time.Format layout for timestamps, or none to omit them
+//
+// If BLAMMO_FORMAT isn't set or isn't recognized, the logger is chosen by
+// NewLogger. Other variables which aren't set or can't be parsed leave the
+// logger's defaults alone. A space is added after the timestamp layout, to
+// separate it from the level tag. When BLAMMO_LEVEL is debug, debug events go
+// to the same writer as errors unless the logger already has a debug writer.
+func NewLoggerFromEnv() *Logger {
+	var l *Logger
+	switch strings.ToLower(os.Getenv("BLAMMO_FORMAT")) {
+	case "console":
+		l = NewConsoleLogger()
+	case "pipe", "logfmt":
+		l = NewPipeLogger()
+	case "cloud":
+		l = NewCloudLogger()
+	case "json", "ndjson":
+		l = NewNDJSONLogger(os.Stdout)
+	case "binary":
+		l = NewBinaryLogger(os.Stdout)
+	default:
+		l = NewLogger()
+	}
+	if lvl, err := ParseLevel(os.Getenv("BLAMMO_LEVEL")); err == nil {
+		l.MinLevel = lvl
+		if lvl == DebugLevel && l.DebugWriter == nil {
+			l.DebugWriter = l.ErrorWriter
+		}
+	}
+	if utc, err := strconv.ParseBool(os.Getenv("BLAMMO_UTC")); err == nil {
+		l.UTC = utc
+	}
+	switch ts := os.Getenv("BLAMMO_TIMESTAMP"); ts {
+	case "":
+	case "none":
+		l.Timestamp = ""
+	default:
+		l.Timestamp = ts + " "
+	}
+	return l
+}
@@ -0,0 +1,87 @@
+package blammo
+
+// NewFanoutLogger creates a logger which sends each event to all of the child
+// loggers provided, so one call can write the same event in several formats,
+// such as text on the console and binary records to a file.
+//
+// The fields of an event have to be kept until Msg is called, because the
+// children can't start rendering until they know the event is going to be
+// written. Rather than keeping a list of values, the fanout logger records the
+// fields once in the binary record format, then replays the record into an
+// event from each child. Each field is therefore encoded once, plus once per
+// child format.
+//
+// Each child applies its own writers, tags, timestamps and other settings.
+// Call stacks are collected by the fanout logger, according to its own
+// MaxCallLevels and StackMinLevel. Floating point formats chosen with FloatFmt
+// aren't passed on, and RawField data is passed on as a raw field.
+func NewFanoutLogger(children ...*Logger) *Logger {
+	fw := &fanoutWriter{children: children}
+	l := &Logger{
+		ErrorWriter:   fw,
+		InfoWriter:    fw,
+		MaxCallLevels: 3,
+		enc:           binaryEncoder{},
+	}
+	for _, c := range children {
+		if c.DebugWriter != nil {
+			l.DebugWriter = fw
+		}
+		if c.AuditWriter != nil {
+			l.AuditWriter = fw
+		}
+	}
+	return l
+}
+
+// fanoutWriter decodes binary records and logs them to its children.
+type fanoutWriter struct {
+	children []*Logger
+}
+
+// Write replays a single binary record to each child, and returns the first
+// error from any of them.
+func (fw *fanoutWriter) Write(p []byte) (int, error) {
+	if len(p) < 4 {
+		return 0, ErrCorruptRecord
+	}
+	rec, err := decodeRecord(p[4:])
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range fw.children {
+		var e *Event
+		if rec.Level == AuditLevel {
+			// The record already has the file and line of the original caller
+			e = c.newEvent(AuditLevel, &c.AuditWriter, c.AuditTag)
+		} else {
+			e = c.Event(rec.Level)
+		}
+		if e == nil {
+			continue
+		}
+		for _, f := range rec.Fields {
+			e.field(f)
+		}
+		// The call stack here would be the fanout writer's
+		e.stack = false
+		e.autoCaller = false
+		if serr := e.send(rec.Message); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Field adds a field decoded from a binary record to the event. A string with
+// an empty key came from RawField.
+func (e *Event) field(f Field) {
+	if v, ok := f.Value.(string); ok && f.Key == "" {
+		e.RawField([]byte(v))
+		return
+	}
+	e.Any(f.Key, f.Value)
+}
@@ -1,8 +1,9 @@
 module github.com/lpar/blammo
 
 require (
+	github.com/go-logr/logr v1.2.3
 	golang.org/x/crypto v0.0.0-20190128193316-c7b33c32a30b
 	golang.org/x/sys v0.0.0-20190124100055-b90733256f2e // indirect
 )
 
-go 1.13
+go 1.14
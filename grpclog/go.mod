@@ -0,0 +1,22 @@
+module github.com/lpar/blammo/grpclog
+
+go 1.22
+
+require (
+	github.com/lpar/blammo v1.2.0
+	google.golang.org/grpc v1.64.0
+)
+
+require (
+	golang.org/x/crypto v0.21.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/term v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
+
+// For working on grpclog and blammo together. Modules which import grpclog
+// ignore this, and use the blammo version required above.
+replace github.com/lpar/blammo => ../
@@ -0,0 +1,89 @@
+// Package grpclog provides gRPC server interceptors which log each RPC to a
+// blammo Logger. It's a separate module, so that only code which uses gRPC
+// depends on it.
+//
+//	srv := grpc.NewServer(
+//		grpc.UnaryInterceptor(grpclog.UnaryServerInterceptor(l)),
+//		grpc.StreamInterceptor(grpclog.StreamServerInterceptor(l)),
+//	)
+package grpclog
+
+import (
+	"context"
+	"time"
+
+	"github.com/lpar/blammo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns an interceptor which logs each unary RPC to l
+// when it completes, at the level given by CodeLevel.
+func UnaryServerInterceptor(l *blammo.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, l, info.FullMethod, start, err).Msg("unary call finished")
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor which logs each streaming RPC
+// to l when it completes, at the level given by CodeLevel.
+func StreamServerInterceptor(l *blammo.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), l, info.FullMethod, start, err).Msg("stream call finished")
+		return err
+	}
+}
+
+// CodeLevel returns the level used to log an RPC which finished with a given
+// status code. Codes which are down to the client, such as NotFound, are
+// logged at info level, codes which suggest trouble at warning level, and
+// codes which mean something is broken at error level.
+func CodeLevel(code codes.Code) blammo.Level {
+	switch code {
+	case codes.OK, codes.Canceled, codes.InvalidArgument, codes.NotFound,
+		codes.AlreadyExists, codes.Unauthenticated:
+		return blammo.InfoLevel
+	case codes.DeadlineExceeded, codes.PermissionDenied, codes.ResourceExhausted,
+		codes.FailedPrecondition, codes.Aborted, codes.OutOfRange, codes.Unavailable:
+		return blammo.WarnLevel
+	}
+	return blammo.ErrorLevel
+}
+
+// LogCall returns an event for a finished RPC, with the fields from the
+// context, the method, status code, duration and peer address.
+func logCall(ctx context.Context, l *blammo.Logger, method string, start time.Time, err error) *blammo.Event {
+	code := status.Code(err)
+	e := l.Event(CodeLevel(code)).Ctx(ctx).
+		Str("grpc.method", method).
+		Str("grpc.code", code.String()).
+		DurBoth("grpc.duration", time.Since(start))
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		e = e.Str("grpc.peer", p.Addr.String())
+	}
+	if err != nil {
+		e = e.Err(err)
+	}
+	return e
+}
+
+// Status adds a gRPC status error to an event as @grpc_code and
+// @grpc_message, so that errors can be searched by code. Errors which don't
+// carry a gRPC status are added as Event.Err adds them.
+func Status(e *blammo.Event, err error) *blammo.Event {
+	if err == nil {
+		return e.Err(err)
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return e.Err(err)
+	}
+	return e.Str("@grpc_code", s.Code().String()).Str("@grpc_message", s.Message())
+}
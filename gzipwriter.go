@@ -0,0 +1,104 @@
+package blammo
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CompressedFlushInterval is how often a compressed file logger flushes its
+// compressed output to the file.
+const CompressedFlushInterval = 10 * time.Second
+
+// NewCompressedFileLogger creates a new logger which writes all events to a
+// single gzip compressed file, with no ANSI codes and timestamps to 1 second
+// precision. If the file already exists, a new gzip member is appended to it,
+// which gunzip and zcat read as a continuation. Output is flushed to the file
+// every CompressedFlushInterval, so that a crash loses little, and when the
+// logger is closed, which must be done to finish the file properly.
+//
+// The file can't usefully be followed with tail -f, and grows without limit, so
+// it's best paired with external log rotation.
+func NewCompressedFileLogger(path string) (*Logger, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("can't open compressed log: %w", err)
+	}
+	w := &gzipWriter{
+		file: f,
+		gz:   gzip.NewWriter(f),
+		done: make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	l := &Logger{
+		ErrorWriter:   w,
+		InfoWriter:    w,
+		DebugWriter:   nil,
+		Timestamp:     timestampFormat,
+		MaxCallLevels: 3,
+		ErrorTag:      []byte("[ERROR] "),
+		WarnTag:       []byte("[WARN ] "),
+		InfoTag:       []byte("[INFO ] "),
+		DebugTag:      []byte("[DEBUG] "),
+		AuditTag:      []byte("[AUDIT] "),
+		KeyStart:      []byte(""),
+		KeyEnd:        []byte(""),
+		Closer: func() {
+			w.Close()
+		},
+	}
+	return l, nil
+}
+
+// gzipWriter compresses writes to a file, flushing periodically.
+type gzipWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	gz   *gzip.Writer
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (w *gzipWriter) run() {
+	defer w.wg.Done()
+	t := time.NewTicker(CompressedFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			w.mu.Lock()
+			w.gz.Flush()
+			w.mu.Unlock()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.gz.Write(p)
+}
+
+// Close stops the flushing goroutine, then closes the gzip stream and the file.
+// Closing again does nothing, and returns the same error.
+func (w *gzipWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.wg.Wait()
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.closeErr = w.gz.Close()
+		if err := w.file.Close(); w.closeErr == nil {
+			w.closeErr = err
+		}
+	})
+	return w.closeErr
+}
@@ -0,0 +1,270 @@
+package blammo
+
+import (
+	"encoding/hex"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// NewNDJSONLogger creates a new logger which writes newline-delimited JSON to
+// the writer provided, as expected by log shippers such as Vector and Fluent
+// Bit. Each event is a single line holding one JSON object, with the time as
+// timestamp in RFC 3339 format with nanoseconds, the level in lower case as
+// level, the message as message, and the event's fields.
+func NewNDJSONLogger(w io.Writer) *Logger {
+	return &Logger{
+		ErrorWriter:   w,
+		InfoWriter:    w,
+		DebugWriter:   nil,
+		UTC:           true,
+		MaxCallLevels: 3,
+		enc:           jsonEncoder{},
+	}
+}
+
+// NewConsoleJSONLogger creates a new logger which writes JSON like
+// NewNDJSONLogger, to stdout and stderr, with timestamps in local time. If
+// stdout is a terminal and the NO_COLOR environment variable isn't set, keys,
+// values and levels are colored with ANSI codes for reading while developing,
+// which means the output is no longer valid JSON.
+func NewConsoleJSONLogger() *Logger {
+	color := terminal.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == "" &&
+		enableANSI(os.Stdout) && enableANSI(os.Stderr)
+	return &Logger{
+		ErrorWriter:   os.Stderr,
+		InfoWriter:    os.Stdout,
+		DebugWriter:   nil,
+		MaxCallLevels: 3,
+		enc:           jsonEncoder{color: color},
+	}
+}
+
+// ANSI codes used by the colored JSON format, following jq.
+const (
+	jsonKeyColor    = "\x1b[34;1m"
+	jsonStringColor = "\x1b[32m"
+	jsonNumberColor = "\x1b[33m"
+	jsonResetColor  = "\x1b[0m"
+)
+
+// jsonEncoder writes each event as a JSON object on a line of its own. The
+// message is written last, as the position of keys in an object doesn't
+// matter, which saves moving the fields. If color is set, ANSI codes are
+// added around keys and values.
+type jsonEncoder struct {
+	color bool
+}
+
+// LevelColor returns the ANSI code for a level, matching the console logger's
+// tags.
+func levelColor(level Level) string {
+	switch level {
+	case DebugLevel:
+		return "\x1b[37m"
+	case InfoLevel:
+		return "\x1b[92m"
+	case WarnLevel:
+		return "\x1b[93m"
+	case AuditLevel:
+		return "\x1b[95m"
+	}
+	return "\x1b[91m"
+}
+
+// SetColor writes an ANSI code, if the encoder is coloring its output.
+func (enc jsonEncoder) setColor(e *Event, code string) {
+	if enc.color {
+		e.txt = append(e.txt, code...)
+	}
+}
+
+func (enc jsonEncoder) begin(e *Event, l *Logger, level Level, tag []byte) {
+	t := time.Now()
+	if l.UTC {
+		t = t.UTC()
+	}
+	e.txt = append(e.txt, '{')
+	enc.name(e, "timestamp", "")
+	enc.setColor(e, jsonStringColor)
+	e.txt = append(e.txt, '"')
+	e.txt = t.AppendFormat(e.txt, time.RFC3339Nano)
+	e.txt = append(e.txt, '"')
+	enc.setColor(e, jsonResetColor)
+	enc.key(e, "level", "")
+	enc.setColor(e, levelColor(level))
+	e.txt = append(e.txt, '"')
+	e.txt = appendLowerASCII(e.txt, level.String())
+	e.txt = append(e.txt, '"')
+	enc.setColor(e, jsonResetColor)
+}
+
+// The comma is left out for the first key in an object inside an array.
+func (enc jsonEncoder) key(e *Event, key string, suffix string) {
+	if e.txt[len(e.txt)-1] != '{' {
+		e.txt = append(e.txt, ',')
+	}
+	enc.name(e, key, suffix)
+}
+
+// Name writes a key and colon, without the comma separating it from the
+// previous value.
+func (enc jsonEncoder) name(e *Event, key string, suffix string) {
+	enc.setColor(e, jsonKeyColor)
+	e.txt = append(e.txt, '"')
+	e.txt = appendJSONString(e.txt, key)
+	e.txt = appendJSONString(e.txt, suffix)
+	e.txt = append(e.txt, '"')
+	enc.setColor(e, jsonResetColor)
+	e.txt = append(e.txt, ':')
+}
+
+func (enc jsonEncoder) str(e *Event, s string) {
+	enc.setColor(e, jsonStringColor)
+	e.txt = append(e.txt, '"')
+	e.txt = appendJSONString(e.txt, s)
+	e.txt = append(e.txt, '"')
+	enc.setColor(e, jsonResetColor)
+}
+
+func (enc jsonEncoder) int(e *Event, i int64) {
+	enc.setColor(e, jsonNumberColor)
+	e.txt = strconv.AppendInt(e.txt, i, 10)
+	enc.setColor(e, jsonResetColor)
+}
+
+func (enc jsonEncoder) uint(e *Event, u uint64) {
+	enc.setColor(e, jsonNumberColor)
+	e.txt = strconv.AppendUint(e.txt, u, 10)
+	enc.setColor(e, jsonResetColor)
+}
+
+// NaN and infinite values aren't valid JSON numbers, so they're written as
+// null unless quoted strings are asked for.
+func (enc jsonEncoder) float(e *Event, f float64, fmt byte, prec int, bitSize int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		if e.nonFinite == NonFiniteQuoted {
+			enc.setColor(e, jsonStringColor)
+			e.txt = appendFloat(e.txt, f, fmt, prec, bitSize, NonFiniteQuoted)
+			enc.setColor(e, jsonResetColor)
+		} else {
+			e.txt = append(e.txt, "null"...)
+		}
+		return
+	}
+	enc.setColor(e, jsonNumberColor)
+	e.txt = strconv.AppendFloat(e.txt, f, fmt, prec, bitSize)
+	enc.setColor(e, jsonResetColor)
+}
+
+func (jsonEncoder) bool(e *Event, b bool) {
+	e.txt = strconv.AppendBool(e.txt, b)
+}
+
+func (enc jsonEncoder) time(e *Event, t time.Time) {
+	enc.setColor(e, jsonStringColor)
+	e.txt = append(e.txt, '"')
+	e.txt = t.AppendFormat(e.txt, time.RFC3339Nano)
+	e.txt = append(e.txt, '"')
+	enc.setColor(e, jsonResetColor)
+}
+
+func (enc jsonEncoder) duration(e *Event, d time.Duration) {
+	enc.setColor(e, jsonStringColor)
+	e.txt = append(e.txt, '"')
+	e.txt = appendDuration(e.txt, d)
+	e.txt = append(e.txt, '"')
+	enc.setColor(e, jsonResetColor)
+}
+
+func (enc jsonEncoder) bytes(e *Event, b []byte) {
+	enc.setColor(e, jsonStringColor)
+	e.txt = append(e.txt, '"')
+	n := len(e.txt)
+	e.txt = append(e.txt, make([]byte, hex.EncodedLen(len(b)))...)
+	hex.Encode(e.txt[n:], b)
+	e.txt = append(e.txt, '"')
+	enc.setColor(e, jsonResetColor)
+}
+
+// Decimals are written as JSON numbers, which are exact decimal text anyway.
+func (enc jsonEncoder) decimal(e *Event, units int64, scale int) {
+	enc.setColor(e, jsonNumberColor)
+	e.txt = appendDecimal(e.txt, units, scale)
+	enc.setColor(e, jsonResetColor)
+}
+
+// Raw data must be a "key":value fragment. As for keys, the comma is left out
+// at the start of an object inside an array.
+func (jsonEncoder) raw(e *Event, data []byte) {
+	if e.txt[len(e.txt)-1] != '{' {
+		e.txt = append(e.txt, ',')
+	}
+	e.txt = append(e.txt, data...)
+}
+
+func (enc jsonEncoder) end(e *Event, msg string) {
+	enc.key(e, "message", "")
+	enc.str(e, msg)
+	e.txt = append(e.txt, '}', '\n')
+}
+
+// AppendLowerASCII appends s converted to lower case, without allocating.
+func appendLowerASCII(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+const hexDigits = "0123456789abcdef"
+
+// AppendJSONString appends s to dst with the escaping needed inside a JSON
+// string. Invalid UTF-8 is replaced with the Unicode replacement character.
+func appendJSONString(dst []byte, s string) []byte {
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' && c < utf8.RuneSelf {
+			i++
+			continue
+		}
+		if c < utf8.RuneSelf {
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i++
+			start = i
+			continue
+		}
+		i += size
+	}
+	return append(dst, s[start:]...)
+}
@@ -0,0 +1,60 @@
+package blammo
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// LineWriter is an io.Writer which buffers output and only passes complete
+// lines on to the writer it wraps. Logger always writes whole lines in a single
+// Write, so this is mostly useful when whatever sits in front of a network sink
+// might split writes up.
+type LineWriter struct {
+	mu    sync.Mutex
+	inner io.Writer
+	buf   []byte
+}
+
+// NewLineWriter creates a LineWriter which forwards complete lines to inner.
+func NewLineWriter(inner io.Writer) *LineWriter {
+	return &LineWriter{
+		inner: inner,
+		buf:   make([]byte, 0, bufferSize),
+	}
+}
+
+// Write buffers the data provided, then writes any complete lines to the inner
+// writer in a single Write call. Any trailing partial line is held back until
+// the rest of it arrives, or until Close is called.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	eol := bytes.LastIndexByte(w.buf, '\n')
+	if eol < 0 {
+		return len(p), nil
+	}
+	n, err := w.inner.Write(w.buf[:eol+1])
+	w.drop(n)
+	return len(p), err
+}
+
+// Close writes out any partial line still in the buffer. It doesn't close the
+// inner writer.
+func (w *LineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) == 0 {
+		return nil
+	}
+	n, err := w.inner.Write(w.buf)
+	w.drop(n)
+	return err
+}
+
+// Drop discards the first n bytes of the buffer, after they've been written.
+func (w *LineWriter) drop(n int) {
+	rest := copy(w.buf, w.buf[n:])
+	w.buf = w.buf[:rest]
+}
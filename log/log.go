@@ -29,11 +29,19 @@ func Error() *blammo.Event {
 	return Logger.Error().CallStack()
 }
 
-// SetDebug switches debugging on or off
+// Event returns a logging event for the level specified
+func Event(level blammo.Level) *blammo.Event {
+	if level == blammo.AuditLevel {
+		return Logger.AuditSkip(1)
+	}
+	return Logger.Event(level)
+}
+
+// SetDebug switches debugging on or off. It's safe to call while logging.
 func SetDebug(enabled bool) {
 	if enabled {
-		Logger.DebugWriter = os.Stderr
+		Logger.SetDebugWriter(os.Stderr)
 		return
 	}
-	Logger.DebugWriter = nil
+	Logger.SetDebugWriter(nil)
 }
@@ -0,0 +1,23 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/lpar/blammo"
+)
+
+func TestAuditEvent(t *testing.T) {
+	var buf bytes.Buffer
+	Logger.AuditWriter = &buf
+	defer func() { Logger.AuditWriter = nil }()
+	_, _, line, _ := runtime.Caller(0)
+	Event(blammo.AuditLevel).Msg("audit")
+	want := fmt.Sprintf("/log_test.go @line_0=%d\n", line+1)
+	if got := buf.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
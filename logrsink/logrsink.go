@@ -0,0 +1,96 @@
+// Package logrsink lets a blammo Logger be used through the go-logr/logr API,
+// as used by Kubernetes controllers and other cloud-native tools. It's kept
+// separate so that only code which needs logr depends on it.
+//
+//	log := logr.New(logrsink.New(blammo.NewLogger()))
+package logrsink
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/lpar/blammo"
+)
+
+// sink implements logr.LogSink on top of a blammo Logger.
+type sink struct {
+	l      *blammo.Logger
+	name   string
+	values []interface{}
+	depth  int
+}
+
+// New returns a logr.LogSink which writes to l. logr verbosity 0 is logged at
+// info level, and higher verbosities at debug level. Names given to WithName
+// are joined with slashes and logged as @logger.
+func New(l *blammo.Logger) logr.LogSink {
+	return &sink{l: l}
+}
+
+// Init records how many levels of logr code are between the sink and the code
+// doing the logging, so that the call stack or caller written for events at
+// the logger's StackMinLevel or CallerLevels starts at that code.
+func (s *sink) Init(info logr.RuntimeInfo) {
+	s.depth = info.CallDepth
+}
+
+// WithCallDepth returns a sink which skips another depth levels of call stack,
+// for helper functions which log on behalf of their callers.
+func (s *sink) WithCallDepth(depth int) logr.LogSink {
+	ns := *s
+	ns.depth += depth
+	return &ns
+}
+
+// Enabled reports whether the logger is writing events at the level the
+// verbosity is logged at.
+func (s *sink) Enabled(level int) bool {
+	if level > 0 {
+		return s.l.Enabled(blammo.DebugLevel)
+	}
+	return s.l.Enabled(blammo.InfoLevel)
+}
+
+// Info logs a message at info or debug level, depending on the verbosity.
+func (s *sink) Info(level int, msg string, keysAndValues ...interface{}) {
+	var e *blammo.Event
+	if level > 0 {
+		e = s.l.Debug()
+	} else {
+		e = s.l.Info()
+	}
+	s.fields(e).KeysAndValues(keysAndValues...).Msg(msg)
+}
+
+// Error logs an error message, with the error as @error.
+func (s *sink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.fields(s.l.Error().Err(err)).KeysAndValues(keysAndValues...).Msg(msg)
+}
+
+// WithValues returns a sink which adds the keys and values to every message.
+func (s *sink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	ns := *s
+	ns.values = make([]interface{}, 0, len(s.values)+len(keysAndValues))
+	ns.values = append(ns.values, s.values...)
+	ns.values = append(ns.values, keysAndValues...)
+	return &ns
+}
+
+// WithName returns a sink with name added to the logger name.
+func (s *sink) WithName(name string) logr.LogSink {
+	ns := *s
+	if s.name != "" {
+		ns.name = s.name + "/" + name
+	} else {
+		ns.name = name
+	}
+	return &ns
+}
+
+// Fields adds the logger name and stored values to an event, and skips the
+// sink and logr's own levels of call stack.
+func (s *sink) fields(e *blammo.Event) *blammo.Event {
+	e = e.CallerSkip(s.depth + 1)
+	if s.name != "" {
+		e = e.Str("@logger", s.name)
+	}
+	return e.KeysAndValues(s.values...)
+}
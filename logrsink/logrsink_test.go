@@ -0,0 +1,92 @@
+package logrsink
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/lpar/blammo"
+)
+
+func TestOutput(t *testing.T) {
+	var buf bytes.Buffer
+	l := blammo.NewCloudLogger()
+	l.ErrorWriter = &buf
+	l.InfoWriter = &buf
+	l.DebugWriter = &buf
+	log := logr.New(New(l))
+
+	log.Info("hello", "k", "v")
+	log.V(1).Info("verbose", "n", 1)
+	log.Error(errors.New("boom"), "failed")
+	log.WithName("a").WithName("b").WithValues("x", 1).Info("named", "y", 2)
+	l.SetDebugWriter(nil)
+	log.V(2).Info("dropped")
+
+	want := []string{
+		"[INFO ] hello k=v\n",
+		"[DEBUG] verbose n=1\n",
+		"[ERROR] failed @error=boom\n",
+		"[INFO ] named @logger=a/b x=1 y=2\n",
+	}
+	if got := buf.String(); got != strings.Join(want, "") {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
+
+// logHere logs through a helper which asks for its own frame to be skipped.
+func logHere(log logr.Logger) {
+	log.WithCallDepth(1).Info("helper")
+}
+
+func TestCallDepth(t *testing.T) {
+	var buf bytes.Buffer
+	l := blammo.NewCloudLogger()
+	l.InfoWriter = &buf
+	l.CallerLevels = blammo.Levels(blammo.InfoLevel)
+	log := logr.New(New(l))
+
+	_, _, line, _ := runtime.Caller(0)
+	log.Info("direct")
+	logHere(log)
+	got := strings.Split(buf.String(), "\n")
+	for i, msg := range []string{"direct", "helper"} {
+		want := fmt.Sprintf("/logrsink_test.go @line_0=%d", line+1+i)
+		if !strings.HasPrefix(got[i], "[INFO ] "+msg+" ") || !strings.Contains(got[i]+" ", want+" ") {
+			t.Errorf("got %q, expected %q", got[i], want)
+		}
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	l := blammo.NewCloudLogger()
+	l.InfoWriter = ioutil.Discard
+	s := New(l)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l.SetDebugWriter(&bytes.Buffer{})
+			l.SetDebugWriter(nil)
+			l.SetLevel(blammo.WarnLevel)
+			l.SetLevel(0)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		s.Enabled(0)
+		s.Enabled(1)
+	}
+	<-done
+	if !s.Enabled(0) || s.Enabled(1) {
+		t.Errorf("got %v, %v, expected info only", s.Enabled(0), s.Enabled(1))
+	}
+	l.SetLevel(blammo.WarnLevel)
+	if s.Enabled(0) {
+		t.Error("info enabled below the minimum level")
+	}
+}
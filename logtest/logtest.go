@@ -0,0 +1,108 @@
+// Package logtest provides helpers for using blammo loggers in tests.
+package logtest
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lpar/blammo"
+)
+
+// buffer is a bytes.Buffer which is safe to write to from multiple goroutines.
+type buffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// Take returns everything written so far, and empties the buffer.
+func (b *buffer) take() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.buf.String()
+	b.buf.Reset()
+	return s
+}
+
+// NewDeferredTestLogger creates a logger which collects all of its output,
+// including debug output, in memory. The output is only passed to tb.Log if the
+// test has failed, so passing tests stay quiet.
+//
+// The function returned writes out the output collected so far if the test has
+// failed, and discards it otherwise. It's registered with tb.Cleanup, so you
+// only need to call it yourself if you want the output sooner.
+func NewDeferredTestLogger(tb testing.TB) (*blammo.Logger, func()) {
+	buf := &buffer{}
+	l := blammo.NewPipeLogger()
+	l.ErrorWriter = buf
+	l.InfoWriter = buf
+	l.DebugWriter = buf
+	flush := func() {
+		out := buf.take()
+		if out != "" && tb.Failed() {
+			tb.Log("log output:\n" + strings.TrimSuffix(out, "\n"))
+		}
+	}
+	tb.Cleanup(flush)
+	return l, flush
+}
+
+// AssertField fails the test if no line of output, in blammo's text format,
+// has a field key whose value is want. The output must be from a logger
+// without FastMsg set, and the messages mustn't contain = signs, or they'll be
+// mistaken for parts of fields.
+func AssertField(tb testing.TB, output []byte, key, want string) {
+	tb.Helper()
+	var found []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if v, ok := lineFields(line)[key]; ok {
+			if v == want {
+				return
+			}
+			found = append(found, v)
+		}
+	}
+	if found == nil {
+		tb.Errorf("log field %s is missing, expected %s=%s", key, key, want)
+		return
+	}
+	tb.Errorf("log field %s has values %q, expected %q", key, found, want)
+}
+
+// AssertNoField fails the test if any line of output, in blammo's text format,
+// has a field key, for example to check that a value has been redacted.
+func AssertNoField(tb testing.TB, output []byte, key string) {
+	tb.Helper()
+	for _, line := range strings.Split(string(output), "\n") {
+		if v, ok := lineFields(line)[key]; ok {
+			tb.Errorf("log field %s is present with value %q, expected it to be missing", key, v)
+			return
+		}
+	}
+}
+
+// LineFields returns the key=value fields of a line in blammo's text format.
+// Values aren't quoted, so a word without an = sign is taken to be part of the
+// value before it. Nor is the message marked, which means a word in it that
+// contains an = sign is taken as a field, and the message of a FastMsg logger,
+// which comes after the fields, is taken as part of the last value.
+func lineFields(line string) map[string]string {
+	fields := make(map[string]string)
+	key := ""
+	for _, word := range strings.Fields(line) {
+		if i := strings.IndexByte(word, '='); i > 0 {
+			key = word[:i]
+			fields[key] = word[i+1:]
+		} else if key != "" {
+			fields[key] += " " + word
+		}
+	}
+	return fields
+}
@@ -0,0 +1,64 @@
+package logtest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var lineFieldsTests = []struct {
+	line string
+	want map[string]string
+}{
+	{"", map[string]string{}},
+	{"[INFO ] hello", map[string]string{}},
+	{"[INFO ] hello a=1 b=two", map[string]string{"a": "1", "b": "two"}},
+	{"2019-02-03T04:05:06Z [WARN ] hello a=1", map[string]string{"a": "1"}},
+	{"[INFO ] hello a=two words b=", map[string]string{"a": "two words", "b": ""}},
+	{"[INFO ] hello a=x=y", map[string]string{"a": "x=y"}},
+	// The limitations: a message word with an = sign is taken as a field, and
+	// a FastMsg message is taken as part of the last value
+	{"[INFO ] set x=1 ok a=2", map[string]string{"x": "1 ok", "a": "2"}},
+	{"[INFO ] a=1 hello", map[string]string{"a": "1 hello"}},
+}
+
+func TestLineFields(t *testing.T) {
+	for _, tdat := range lineFieldsTests {
+		if got := lineFields(tdat.line); !reflect.DeepEqual(got, tdat.want) {
+			t.Errorf("%q gave %v, expected %v", tdat.line, got, tdat.want)
+		}
+	}
+}
+
+// recorder is a testing.TB which records errors instead of failing.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertField(t *testing.T) {
+	out := []byte("[INFO ] first a=1\n[INFO ] second a=2 b=secret\n")
+	r := &recorder{}
+	AssertField(r, out, "a", "2")
+	AssertNoField(r, out, "c")
+	if len(r.errors) != 0 {
+		t.Errorf("unexpected errors: %q", r.errors)
+	}
+	AssertField(r, out, "a", "3")
+	AssertField(r, out, "c", "1")
+	AssertNoField(r, out, "b")
+	want := []string{
+		`log field a has values ["1" "2"], expected "3"`,
+		"log field c is missing, expected c=1",
+		`log field b is present with value "secret", expected it to be missing`,
+	}
+	if !reflect.DeepEqual(r.errors, want) {
+		t.Errorf("got errors %q, expected %q", r.errors, want)
+	}
+}
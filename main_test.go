@@ -1,8 +1,25 @@
 package blammo
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
-	)
+	"time"
+)
 
 var spliceTests = []struct {
 	txt string
@@ -24,3 +41,854 @@ func TestSplice(t *testing.T) {
 		})
 	}
 }
+
+var decimalTests = []struct {
+	units int64
+	scale int
+	out   string
+}{
+	{12345, 2, "123.45"},
+	{-12345, 2, "-123.45"},
+	{5, 2, "0.05"},
+	{-5, 3, "-0.005"},
+	{100, 2, "1.00"},
+	{0, 2, "0.00"},
+	{42, 0, "42"},
+	{42, -3, "42000"},
+	{0, -3, "0"},
+	{-9223372036854775808, 4, "-922337203685477.5808"},
+}
+
+func TestDecimal(t *testing.T) {
+	for _, tdat := range decimalTests {
+		t.Run(tdat.out, func(t *testing.T) {
+			x := string(appendDecimal([]byte{}, tdat.units, tdat.scale))
+			if x != tdat.out {
+				t.Errorf("got %s, expected %s", x, tdat.out)
+			}
+		})
+	}
+}
+
+var durationTests = []time.Duration{
+	0, 1, 999, time.Microsecond, 1500 * time.Nanosecond, 1001 * time.Microsecond,
+	1500 * time.Millisecond, time.Second + time.Nanosecond, 90 * time.Second,
+	time.Hour, 26*time.Hour + 3*time.Minute + 10*time.Millisecond, -2500 * time.Microsecond,
+}
+
+func TestDuration(t *testing.T) {
+	for _, d := range durationTests {
+		t.Run(d.String(), func(t *testing.T) {
+			x := string(appendDuration([]byte{}, d))
+			if x != d.String() {
+				t.Errorf("got %s, expected %s", x, d.String())
+			}
+		})
+	}
+}
+
+var metricKeyTests = []struct {
+	key string
+	out string
+}{
+	{"already_ok", "already_ok"},
+	{"camelCase", "camel_case"},
+	{"HTTPServer", "http_server"},
+	{"requestID", "request_id"},
+	{"key.size", "key_size"},
+	{"@file_0", "_file_0"},
+	{"2xx", "_2xx"},
+	{"a-b c", "a_b_c"},
+}
+
+func TestMetricKey(t *testing.T) {
+	for _, tdat := range metricKeyTests {
+		t.Run(tdat.key, func(t *testing.T) {
+			x := metricKey(tdat.key)
+			if x != tdat.out {
+				t.Errorf("got %s, expected %s", x, tdat.out)
+			}
+		})
+	}
+}
+
+var floatTests = []struct {
+	f   float64
+	nf  NonFiniteFormat
+	out string
+}{
+	{1.5, NonFiniteBare, "1.5"},
+	{math.NaN(), NonFiniteBare, "NaN"},
+	{math.Inf(1), NonFiniteBare, "+Inf"},
+	{math.Inf(-1), NonFiniteBare, "-Inf"},
+	{1.5, NonFiniteQuoted, "1.5"},
+	{math.NaN(), NonFiniteQuoted, `"NaN"`},
+	{math.Inf(-1), NonFiniteQuoted, `"-Inf"`},
+	{math.Inf(1), NonFiniteNull, "null"},
+}
+
+func TestFloat(t *testing.T) {
+	for _, tdat := range floatTests {
+		t.Run(tdat.out, func(t *testing.T) {
+			x := string(appendFloat([]byte{}, tdat.f, 'G', -1, 64, tdat.nf))
+			if x != tdat.out {
+				t.Errorf("got %s, expected %s", x, tdat.out)
+			}
+		})
+	}
+}
+
+var clampTests = []struct {
+	r   FloatRange
+	in  float64
+	out string
+}{
+	{FloatRange{}, -5000, " f=-5000\n"},
+	{FloatRange{Min: 0, Max: 100}, -5, " f=0 @clamped=true\n"},
+	{FloatRange{Min: 0, Max: 100}, 150, " f=100 @clamped=true\n"},
+	{FloatRange{Min: 0, Max: 100}, 50, " f=50\n"},
+	{FloatRange{Min: math.Inf(-1), Max: 1000}, -5, " f=-5\n"},
+	{FloatRange{Min: math.Inf(-1), Max: 1000}, 2000, " f=1000 @clamped=true\n"},
+	{FloatRange{Min: -1, Max: math.Inf(1)}, 5000, " f=5000\n"},
+	{FloatRange{Min: -1, Max: math.Inf(1)}, -2, " f=-1 @clamped=true\n"},
+	{FloatRange{Min: 0, Max: 100}, math.NaN(), " f=NaN\n"},
+}
+
+func TestClampFloats(t *testing.T) {
+	for _, tdat := range clampTests {
+		var buf bytes.Buffer
+		l := &Logger{InfoWriter: &buf, ClampFloats: tdat.r}
+		l.Info().Float64("f", tdat.in).Send()
+		if buf.String() != tdat.out {
+			t.Errorf("%+v clamped %v to %q, expected %q", tdat.r, tdat.in, buf.String(), tdat.out)
+		}
+		if _, err := json.Marshal(l.Config()); err != nil {
+			t.Errorf("%+v: can't marshal config: %v", tdat.r, err)
+		}
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewBinaryLogger(&buf)
+	when := time.Date(2019, 2, 3, 4, 5, 6, 7, time.UTC)
+	l.Info().Str("s", "hello world").Int("i", -42).Uint64("u", 42).
+		Float64("f", 1.5).Bool("b", true).Time("t", when).
+		Bytes("x", []byte{0xde, 0xad}).Decimal("d", 12345, 2).Msg("first message")
+	l.Error().Msg("second")
+	r := NewBinaryReader(&buf)
+	rec, err := r.Read()
+	if err != nil {
+		t.Fatalf("unexpected error reading first record: %v", err)
+	}
+	if rec.Level != InfoLevel || rec.Message != "first message" {
+		t.Errorf("got level %d message %q", rec.Level, rec.Message)
+	}
+	want := []Field{
+		{"s", "hello world"}, {"i", int64(-42)}, {"u", uint64(42)},
+		{"f", 1.5}, {"b", true}, {"t", when}, {"x", []byte{0xde, 0xad}},
+		{"d", "123.45"},
+	}
+	if len(rec.Fields) != len(want) {
+		t.Fatalf("got %d fields, expected %d", len(rec.Fields), len(want))
+	}
+	for i, f := range rec.Fields {
+		if f.Key != want[i].Key || fmt.Sprint(f.Value) != fmt.Sprint(want[i].Value) {
+			t.Errorf("got %s=%v, expected %s=%v", f.Key, f.Value, want[i].Key, want[i].Value)
+		}
+	}
+	rec, err = r.Read()
+	if err != nil || rec.Level != ErrorLevel || rec.Message != "second" || len(rec.Fields) != 0 {
+		t.Errorf("got %+v, %v for second record", rec, err)
+	}
+	if _, err = r.Read(); err != io.EOF {
+		t.Errorf("got %v, expected EOF", err)
+	}
+}
+
+type joinedErrors []error
+
+func (je joinedErrors) Error() string   { return "multiple\nerrors" }
+func (je joinedErrors) Unwrap() []error { return je }
+
+func TestErrJoined(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCloudLogger()
+	l.ErrorWriter = &buf
+	l.Error().Err(joinedErrors{io.EOF, io.ErrClosedPipe}).Msg("failed")
+	want := "[ERROR] failed @error_0=EOF @error_1=io: read/write on closed pipe\n"
+	if buf.String() != want {
+		t.Errorf("got %q, expected %q", buf.String(), want)
+	}
+}
+
+func TestErrVerbose(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCloudLogger()
+	l.ErrorWriter = &buf
+	l.Error().ErrVerbose(errors.New("first line\nsecond line")).Msg("failed")
+	want := `[ERROR] failed @error="first line\nsecond line" @error_detail="first line\nsecond line"` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, expected %q", buf.String(), want)
+	}
+}
+
+func TestMaxFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCloudLogger()
+	l.InfoWriter = &buf
+	l.MaxFields = 2
+	e := l.Info()
+	for i := 0; i < 1000; i++ {
+		e.Int("i", i)
+	}
+	e.Msg("loop")
+	want := "[INFO ] loop i=0 i=1 @fields_truncated=true\n"
+	if buf.String() != want {
+		t.Errorf("got %q, expected %q", buf.String(), want)
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCloudLogger()
+	l.InfoWriter = &buf
+	e := l.Info()
+	e.writeFrame(0, callerInfo{file: "", line: 0})
+	e.writeFrame(1, callerInfo{file: "/src/app/main.go", line: 0})
+	e.writeFrame(2, callerInfo{file: "", line: 12})
+	e.writeFrame(12, callerInfo{file: "/src/app/util.go", line: 7})
+	e.Msg("frames")
+	want := "[INFO ] frames @file_1=app/main.go @line_2=12 @file_12=app/util.go @line_12=7\n"
+	if buf.String() != want {
+		t.Errorf("got %q, expected %q", buf.String(), want)
+	}
+}
+
+// recurse calls fn from depth nested calls, for deep call stacks.
+func recurse(depth int, fn func()) {
+	if depth == 0 {
+		fn()
+		return
+	}
+	recurse(depth-1, fn)
+}
+
+func TestCallStackN(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCloudLogger()
+	l.InfoWriter = &buf
+	recurse(15, func() {
+		l.Info().CallStackN(12).Msg("deep")
+	})
+	line := buf.String()
+	for i := 0; i < 12; i++ {
+		n := strconv.Itoa(i)
+		if !strings.Contains(line, " @file_"+n+"=") || !strings.Contains(line, " @line_"+n+"=") {
+			t.Errorf("missing level %d in %q", i, line)
+		}
+	}
+	if strings.Contains(line, "@file_12=") {
+		t.Errorf("more than 12 levels in %q", line)
+	}
+}
+
+func TestFanout(t *testing.T) {
+	var tbuf, bbuf bytes.Buffer
+	tl := NewCloudLogger()
+	tl.InfoWriter = &tbuf
+	l := NewFanoutLogger(tl, NewBinaryLogger(&bbuf))
+	l.Info().Str("s", "x").Int("i", 1).DurBoth("d", time.Second).Msg("both")
+	want := "[INFO ] both s=x i=1 d=1s d_ms=1000\n"
+	if tbuf.String() != want {
+		t.Errorf("got %q, expected %q", tbuf.String(), want)
+	}
+	rec, err := NewBinaryReader(&bbuf).Read()
+	if err != nil {
+		t.Fatalf("unexpected error reading record: %v", err)
+	}
+	if rec.Message != "both" || len(rec.Fields) != 4 || rec.Fields[2].Value != time.Second {
+		t.Errorf("got %+v", rec)
+	}
+}
+
+func TestFanoutAudit(t *testing.T) {
+	var buf bytes.Buffer
+	tl := NewCloudLogger()
+	tl.AuditWriter = &buf
+	tl.CallerLevels = Levels(AuditLevel)
+	l := NewFanoutLogger(tl)
+	l.Audit().Str("user", "admin").Msg("login")
+	line := buf.String()
+	if strings.Count(line, "@file_0=") != 1 || !strings.Contains(line, "/main_test.go @line_0=") {
+		t.Errorf("expected one frame from the test, got %q", line)
+	}
+}
+
+func TestAuditCaller(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCloudLogger()
+	l.AuditWriter = &buf
+	l.OutputLevel = AuditLevel
+	stdlog := log.New(&StdWriter{Logger: l, Level: AuditLevel}, "", 0)
+	_, _, line, _ := runtime.Caller(0)
+	l.Audit().Msg("audit")
+	l.Event(AuditLevel).Msg("event")
+	stdlog.Print("stdwriter")
+	l.Output(1, "output")
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(got) != 4 {
+		t.Fatalf("got %q, expected 4 lines", got)
+	}
+	for i, g := range got {
+		want := fmt.Sprintf("/main_test.go @line_0=%d", line+1+i)
+		if strings.Count(g, "@file_0=") != 1 || !strings.Contains(g+" ", want+" ") {
+			t.Errorf("got %q, expected %q", g, want)
+		}
+	}
+}
+
+// csvEncoder is a minimal Encoder which writes level,message,key,value,...
+type csvEncoder struct{}
+
+func (csvEncoder) Begin(dst []byte, level Level, tag []byte, t time.Time) []byte {
+	return append(dst, level.String()...)
+}
+func (csvEncoder) AppendKey(dst []byte, key string) []byte {
+	return append(append(dst, ','), key...)
+}
+func (csvEncoder) AppendString(dst []byte, s string) []byte {
+	return append(append(dst, ','), s...)
+}
+func (csvEncoder) AppendInt(dst []byte, i int64) []byte {
+	return strconv.AppendInt(append(dst, ','), i, 10)
+}
+func (csvEncoder) AppendUint(dst []byte, u uint64) []byte {
+	return strconv.AppendUint(append(dst, ','), u, 10)
+}
+func (csvEncoder) AppendFloat(dst []byte, f float64, fmt byte, prec int, bitSize int) []byte {
+	return strconv.AppendFloat(append(dst, ','), f, fmt, prec, bitSize)
+}
+func (csvEncoder) AppendBool(dst []byte, b bool) []byte {
+	return strconv.AppendBool(append(dst, ','), b)
+}
+func (csvEncoder) AppendTime(dst []byte, t time.Time) []byte {
+	return t.AppendFormat(append(dst, ','), time.RFC3339)
+}
+func (csvEncoder) AppendDuration(dst []byte, d time.Duration) []byte {
+	return append(append(dst, ','), d.String()...)
+}
+func (csvEncoder) AppendBytes(dst []byte, b []byte) []byte {
+	return append(append(dst, ','), b...)
+}
+func (csvEncoder) AppendRaw(dst []byte, data []byte) []byte {
+	return append(append(dst, ','), data...)
+}
+func (csvEncoder) End(dst []byte, msgpos int, msg string) []byte {
+	return append(splice(dst, []byte(","+msg), msgpos), '\n')
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewPipeLogger()
+	l.InfoWriter = &buf
+	l.Encoder = csvEncoder{}
+	l.Info().Str("s", "x").Int("i", -1).Decimal("d", 150, 2).DurBoth("t", time.Second).Msg("hello")
+	want := "INFO,hello,s,x,i,-1,d,1.50,t,1s,t_ms,1000\n"
+	if buf.String() != want {
+		t.Errorf("got %q, expected %q", buf.String(), want)
+	}
+}
+
+func TestTimestampFunc(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewPipeLogger()
+	l.InfoWriter = &buf
+	l.TimestampFunc = func(dst []byte, t time.Time) []byte {
+		return append(dst, "TS "...)
+	}
+	l.Info().Msg("before")
+	l.TimestampAfterTag = true
+	l.Info().Msg("after")
+	want := "TS [INFO ] before\n[INFO ] TS after\n"
+	if buf.String() != want {
+		t.Errorf("got %q, expected %q", buf.String(), want)
+	}
+}
+
+var fastMsgTests = []struct {
+	name string
+	l    *Logger
+	msg  string
+	out  string
+}{
+	{"empty", &Logger{}, "", "\n"},
+	{"message only", &Logger{}, "hello", "hello\n"},
+	{"tag", &Logger{InfoTag: []byte("[INFO ] ")}, "", "[INFO ]\n"},
+	{"unseparated timestamp", &Logger{TimestampFunc: func(dst []byte, t time.Time) []byte {
+		return append(dst, "TS"...)
+	}}, "", "TS\n"},
+}
+
+func TestFastMsg(t *testing.T) {
+	for _, tdat := range fastMsgTests {
+		t.Run(tdat.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tdat.l.InfoWriter = &buf
+			tdat.l.FastMsg = true
+			tdat.l.Info().Msg(tdat.msg)
+			if buf.String() != tdat.out {
+				t.Errorf("got %q, expected %q", buf.String(), tdat.out)
+			}
+		})
+	}
+}
+
+var msgRawTests = []struct {
+	name string
+	l    *Logger
+	msg  string
+	out  string
+}{
+	{"bare", &Logger{}, "relayed line\n", "relayed line\n"},
+	{"no newline", &Logger{}, "relayed line", "relayed line\n"},
+	{"crlf", &Logger{}, "relayed line\r\n", "relayed line\r\n"},
+	{"leading space", &Logger{}, "  indented\n", "  indented\n"},
+	{"empty", &Logger{}, "", "\n"},
+	{"tag", &Logger{InfoTag: []byte("[INFO ] ")}, "relayed\n", "[INFO ] n=1 relayed\n"},
+	{"json", NewNDJSONLogger(nil), "relayed\r\n", `"message":"relayed"}` + "\n"},
+}
+
+func TestMsgRaw(t *testing.T) {
+	for _, tdat := range msgRawTests {
+		t.Run(tdat.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tdat.l.InfoWriter = &buf
+			e := tdat.l.Info()
+			if tdat.l.InfoTag != nil {
+				e = e.Int("n", 1)
+			}
+			e.MsgRaw(tdat.msg)
+			got := buf.String()
+			// Skip the JSON timestamp
+			if i := strings.Index(got, `"message"`); i > 0 {
+				got = got[i:]
+			}
+			if got != tdat.out {
+				t.Errorf("got %q, expected %q", buf.String(), tdat.out)
+			}
+		})
+	}
+}
+
+func TestMsgTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCloudLogger()
+	l.InfoWriter = &buf
+	l.Info().MsgTemplate("user {user_id} logged in from {addr} {unknown}", "user_id", 42, "addr", "10.0.0.1")
+	want := "[INFO ] user 42 logged in from 10.0.0.1 {unknown} user_id=42 addr=10.0.0.1\n"
+	if buf.String() != want {
+		t.Errorf("got %q, expected %q", buf.String(), want)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewNDJSONLogger(&buf)
+	l.Info().Str("s", "tab\there \"quoted\"\n\x01\xff").Int("i", -1).
+		Float64("nan", math.NaN()).Decimal("d", 150, 2).Bool("b", true).Msg("hello")
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "}\n") {
+		t.Fatalf("expected one line, got %q", line)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &obj); err != nil {
+		t.Fatalf("invalid JSON %q: %v", line, err)
+	}
+	want := map[string]interface{}{
+		"level": "info", "message": "hello", "s": "tab\there \"quoted\"\n\x01\ufffd",
+		"i": -1.0, "nan": nil, "d": 1.5, "b": true,
+	}
+	for k, v := range want {
+		if obj[k] != v {
+			t.Errorf("got %s=%#v, expected %#v", k, obj[k], v)
+		}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, obj["timestamp"].(string)); err != nil {
+		t.Errorf("bad timestamp: %v", err)
+	}
+}
+
+func TestNDJSONObject(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewNDJSONLogger(&buf)
+	l.Info().Object("req", func(e *Event) {
+		e.Str("method", "GET").Object("empty", func(*Event) {}).Object("user", func(e *Event) {
+			e.Int("id", 7)
+		})
+	}).Msg("request")
+	var obj struct {
+		Req struct {
+			Method string
+			Empty  map[string]interface{}
+			User   struct{ ID int }
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &obj); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if obj.Req.Method != "GET" || obj.Req.Empty == nil || obj.Req.User.ID != 7 {
+		t.Errorf("got %+v from %q", obj, buf.String())
+	}
+}
+
+func TestNDJSONArray(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewNDJSONLogger(&buf)
+	l.Info().Array("arr", func(a *ArrayCtx) {
+		a.Element().RawField([]byte(`"r":1`)).Int("i", 1)
+		a.Element().Str("s", "x")
+	}).Array("empty", func(*ArrayCtx) {}).Msg("hello")
+	var obj struct {
+		Arr []struct {
+			R int
+			I int
+			S string
+		}
+		Empty []interface{}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &obj); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if len(obj.Arr) != 2 || obj.Arr[0].R != 1 || obj.Arr[0].I != 1 || obj.Arr[1].S != "x" || len(obj.Empty) != 0 {
+		t.Errorf("got %+v from %q", obj, buf.String())
+	}
+}
+
+func TestConfig(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewNDJSONLogger(&buf)
+	l.MinLevel = WarnLevel
+	l.ErrorHandler = func(error) {}
+	l.MaxWriteSize = 16384
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l.SetDebugWriter(nil)
+			l.SetLevel(WarnLevel)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		l.Config()
+	}
+	<-done
+	c := l.Config()
+	if c.Format != "json" || c.Level != WarnLevel || c.InfoWriter != "*bytes.Buffer" ||
+		!c.ErrorHandler || c.MaxWriteSize != 16384 {
+		t.Errorf("got %+v", c)
+	}
+}
+
+func TestDigestWindow(t *testing.T) {
+	for _, window := range []time.Duration{0, -time.Second} {
+		w := NewDigestWriter(ioutil.Discard, window)
+		if w.window != DefaultDigestWindow {
+			t.Errorf("got window %v for %v, expected %v", w.window, window, DefaultDigestWindow)
+		}
+		w.Close()
+	}
+}
+
+func TestDigestFormats(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewDigestWriter(&buf, time.Hour)
+	l := NewNDJSONLogger(w)
+	for i := 0; i < 3; i++ {
+		l.Info().Int("n", 1).Msg("again")
+		time.Sleep(time.Millisecond)
+	}
+	tl := NewCloudLogger()
+	tl.InfoWriter = w
+	tl.Timestamp = time.RFC3339Nano
+	tl.Info().Msg("text")
+	tl.Info().Msg("text")
+	bl := NewBinaryLogger(w)
+	if err := bl.Info().MsgCtx(context.Background(), "binary"); err != ErrDigestBinary {
+		t.Errorf("got %v for a binary record, expected ErrDigestBinary", err)
+	}
+	w.Close()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %q, expected 4 lines", lines)
+	}
+	var digest map[string]interface{}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "{") && strings.Contains(line, "@suppressed") {
+			if err := json.Unmarshal([]byte(line), &digest); err != nil {
+				t.Errorf("bad JSON digest %q: %v", line, err)
+			}
+		} else if strings.Contains(line, "@suppressed") && !strings.HasSuffix(line, " text @suppressed=1 @window=1h0m0s") {
+			t.Errorf("got text digest %q", line)
+		}
+	}
+	if digest["@suppressed"] != 2.0 || digest["@window"] != "1h0m0s" || digest["message"] != "again" {
+		t.Errorf("got JSON digest %v", digest)
+	}
+}
+
+func TestCompressedFileLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blammo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.gz")
+	l, err := NewCompressedFileLogger(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.Info().Int("n", 1).Msg("compressed")
+	l.Close()
+	l.Close()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil || !strings.HasSuffix(string(data), "[INFO ] compressed n=1\n") {
+		t.Errorf("got %q, %v", data, err)
+	}
+}
+
+func TestCycleLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCloudLogger()
+	l.ErrorWriter = &buf
+	cycle := []Level{WarnLevel, ErrorLevel}
+	l.cycleLevel(cycle)
+	l.cycleLevel(cycle)
+	want := "[WARN ] log level changed old=NONE new=WARN\n[WARN ] log level changed old=WARN new=ERROR\n"
+	if buf.String() != want || l.Level() != ErrorLevel {
+		t.Errorf("got %q at %v, expected %q", buf.String(), l.Level(), want)
+	}
+}
+
+// countWriter counts the calls to Write.
+type countWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestBatch(t *testing.T) {
+	var w countWriter
+	l := NewCloudLogger()
+	l.InfoWriter = &w
+	l.ErrorWriter = &w
+	b := l.Batch()
+	first := b.Info().Int("n", 1)
+	b.Warn().Msg("second")
+	first.Msg("first")
+	if w.writes != 0 {
+		t.Fatalf("got %d writes before Flush", w.writes)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "[WARN ] second\n[INFO ] first n=1\n"
+	if w.writes != 1 || w.String() != want {
+		t.Errorf("got %d writes of %q, expected 1 of %q", w.writes, w.String(), want)
+	}
+}
+
+// closeWriter fails writes after it's closed.
+type closeWriter struct {
+	mu     sync.Mutex
+	closed bool
+	lines  int
+}
+
+var errWriterClosed = errors.New("write after close")
+
+func (w *closeWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	w.lines += bytes.Count(p, []byte("\n"))
+	return len(p), nil
+}
+
+func (w *closeWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+func TestReopen(t *testing.T) {
+	l := NewCloudLogger()
+	w := &closeWriter{}
+	l.InfoWriter = w
+	l.ErrorWriter = w
+	l.ErrorHandler = func(err error) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	held := l.Info()
+	b := l.Batch()
+	b.Info().Msg("batched")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			l.Info().Int("i", i).Msg("concurrent")
+		}
+	}()
+	var ws []*closeWriter
+	for i := 0; i < 10; i++ {
+		w = &closeWriter{}
+		ws = append(ws, w)
+		l.Reopen(w, w, nil)
+	}
+	<-done
+	held.Msg("held")
+	if err := b.Flush(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, old := range ws[:len(ws)-1] {
+		if !old.closed {
+			t.Error("old writer not closed")
+		}
+	}
+	if w.lines < 2 {
+		t.Errorf("got %d lines in the last writer, expected the held and batched events", w.lines)
+	}
+}
+
+func BenchmarkInt(b *testing.B) {
+	l := NewPipeLogger()
+	l.InfoWriter = ioutil.Discard
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info().Int("n", i).Int("m", -i).Msg("benchmark")
+	}
+}
+
+func BenchmarkUint(b *testing.B) {
+	l := NewPipeLogger()
+	l.InfoWriter = ioutil.Discard
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info().Uint("n", uint(i)).Uint("m", uint(i)*2).Msg("benchmark")
+	}
+}
+
+func BenchmarkCaller(b *testing.B) {
+	l := NewPipeLogger()
+	l.InfoWriter = ioutil.Discard
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info().Caller().Msg("benchmark")
+	}
+}
+
+func BenchmarkMsg(b *testing.B) {
+	l := NewPipeLogger()
+	l.InfoWriter = ioutil.Discard
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info().Str("key", "value").Int("n", i).Msg("benchmark message")
+	}
+}
+
+func BenchmarkFastMsg(b *testing.B) {
+	l := NewPipeLogger()
+	l.InfoWriter = ioutil.Discard
+	l.FastMsg = true
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info().Str("key", "value").Int("n", i).Msg("benchmark message")
+	}
+}
+
+// BenchmarkTimestamp compares the cached default timestamp with formatting the
+// same timestamp for every event.
+func BenchmarkTimestamp(b *testing.B) {
+	b.Run("cached", func(b *testing.B) {
+		l := NewPipeLogger()
+		l.InfoWriter = ioutil.Discard
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l.Info().Msg("benchmark")
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		l := NewPipeLogger()
+		l.InfoWriter = ioutil.Discard
+		l.TimestampFunc = func(dst []byte, t time.Time) []byte {
+			return t.AppendFormat(dst, timestampFormat)
+		}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l.Info().Msg("benchmark")
+		}
+	})
+}
+
+var benchKeys = []string{
+	"method", "path", "status", "duration", "bytes", "remote_addr", "user_agent",
+	"request_id", "user", "tenant", "region", "host", "pid", "component",
+	"attempt", "queue", "topic", "partition", "offset", "trace_id",
+}
+
+// BenchmarkKeys measures the cost of writing recurring colored keys.
+func BenchmarkKeys(b *testing.B) {
+	l := NewPipeLogger()
+	l.InfoWriter = ioutil.Discard
+	l.KeyStart = []byte("\x1b[36m")
+	l.KeyEnd = []byte("\x1b[0m")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		e := l.Info()
+		for _, k := range benchKeys {
+			e.Int(k, i)
+		}
+		e.Msg("benchmark")
+	}
+}
+
+var detectLevelTests = []struct {
+	line  string
+	level Level
+	msg   string
+}{
+	{"ERROR: disk full", ErrorLevel, "disk full"},
+	{"[WARN] low memory", WarnLevel, "low memory"},
+	{"warning something odd", WarnLevel, "something odd"},
+	{"  DEBUG x=1", DebugLevel, "x=1"},
+	{"Information overload", 0, "Information overload"},
+	{"plain message", 0, "plain message"},
+}
+
+func TestDetectLevel(t *testing.T) {
+	for _, tdat := range detectLevelTests {
+		t.Run(tdat.line, func(t *testing.T) {
+			lvl, msg, _ := detectLevel([]byte(tdat.line))
+			if lvl != tdat.level || string(msg) != tdat.msg {
+				t.Errorf("got %d %q, expected %d %q", lvl, msg, tdat.level, tdat.msg)
+			}
+		})
+	}
+}
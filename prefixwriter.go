@@ -0,0 +1,41 @@
+package blammo
+
+import (
+	"io"
+	"sync"
+)
+
+// PrefixWriter is an io.Writer which puts a fixed prefix in front of each
+// Write, such as the stream marker some container log drivers expect. Logger
+// writes one line per Write, so each line gets the prefix. A Batch writes
+// several lines at once, so it mustn't be used with a PrefixWriter.
+type PrefixWriter struct {
+	mu     sync.Mutex
+	inner  io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+// NewPrefixWriter creates a PrefixWriter which writes to inner with prefix in
+// front of each line.
+func NewPrefixWriter(inner io.Writer, prefix []byte) *PrefixWriter {
+	return &PrefixWriter{
+		inner:  inner,
+		prefix: prefix,
+		buf:    make([]byte, 0, bufferSize),
+	}
+}
+
+// Write writes the prefix and p to the inner writer in a single Write call, so
+// that the two can't be split up by other writers.
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(append(w.buf[:0], w.prefix...), p...)
+	n, err := w.inner.Write(w.buf)
+	n -= len(w.prefix)
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
@@ -0,0 +1,197 @@
+// Package protolog writes blammo events as length-delimited protocol buffer
+// records, for log ingestion APIs which accept protobuf. The schema is in
+// record.proto; each record is preceded by its length as a varint.
+//
+//	l := protolog.New(w)
+//	l.Info().Str("user", name).Msg("logged in")
+//
+// The records are encoded directly, rather than through generated types, so
+// that blammo doesn't depend on a protobuf runtime; the output is checked
+// against the schema by the separate schematest module, which does. Lengths
+// are written as five byte varints, padded with continuation bytes where
+// necessary, which protobuf parsers accept; this allows records up to 32 GiB.
+package protolog
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	"github.com/lpar/blammo"
+)
+
+// New creates a new logger which writes length-delimited Record messages to
+// w. Debug events are off unless DebugWriter is set.
+func New(w io.Writer) *blammo.Logger {
+	return &blammo.Logger{
+		ErrorWriter:   w,
+		InfoWriter:    w,
+		DebugWriter:   nil,
+		MaxCallLevels: 3,
+		Encoder:       Encoder{},
+	}
+}
+
+// Protobuf tags for the fields of Record and Field, combining the field number
+// and wire type.
+const (
+	recordLevel     = 1<<3 | 0
+	recordTimestamp = 2<<3 | 1
+	recordMessage   = 3<<3 | 2
+	recordField     = 4<<3 | 2
+
+	fieldKey      = 1<<3 | 2
+	fieldString   = 2<<3 | 2
+	fieldInt      = 3<<3 | 0
+	fieldUint     = 4<<3 | 0
+	fieldDouble   = 5<<3 | 1
+	fieldBool     = 6<<3 | 0
+	fieldTime     = 7<<3 | 1
+	fieldDuration = 8<<3 | 0
+	fieldBytes    = 9<<3 | 2
+)
+
+// lengthSize is the size of a padded length placeholder.
+const lengthSize = 5
+
+// headerSize is the size of what Begin writes: the record length, the level
+// and the timestamp.
+const headerSize = lengthSize + 2 + 9
+
+// Encoder is a blammo.Encoder which writes each event as a Record message. It
+// can be used as Logger.Encoder directly, though New is simpler.
+type Encoder struct{}
+
+// Begin writes a placeholder for the record length, then the level and time.
+func (Encoder) Begin(dst []byte, level blammo.Level, tag []byte, t time.Time) []byte {
+	dst = append(dst, make([]byte, lengthSize)...)
+	dst = append(dst, recordLevel, byte(level))
+	dst = append(dst, recordTimestamp)
+	return appendFixed64(dst, uint64(t.UnixNano()))
+}
+
+// AppendKey starts a Field message, with a placeholder for its length which is
+// filled in by End.
+func (Encoder) AppendKey(dst []byte, key string) []byte {
+	dst = append(dst, recordField)
+	dst = append(dst, make([]byte, lengthSize)...)
+	return appendString(dst, fieldKey, key)
+}
+
+// AppendString writes a string value.
+func (Encoder) AppendString(dst []byte, s string) []byte {
+	return appendString(dst, fieldString, s)
+}
+
+// AppendInt writes an integer value.
+func (Encoder) AppendInt(dst []byte, i int64) []byte {
+	return appendVarint(append(dst, fieldInt), uint64(i))
+}
+
+// AppendUint writes an unsigned integer value.
+func (Encoder) AppendUint(dst []byte, u uint64) []byte {
+	return appendVarint(append(dst, fieldUint), u)
+}
+
+// AppendFloat writes a floating point value as a double. The format is
+// ignored.
+func (Encoder) AppendFloat(dst []byte, f float64, fmt byte, prec int, bitSize int) []byte {
+	return appendFixed64(append(dst, fieldDouble), math.Float64bits(f))
+}
+
+// AppendBool writes a boolean value.
+func (Encoder) AppendBool(dst []byte, b bool) []byte {
+	if b {
+		return append(dst, fieldBool, 1)
+	}
+	return append(dst, fieldBool, 0)
+}
+
+// AppendTime writes a time as nanoseconds since the Unix epoch.
+func (Encoder) AppendTime(dst []byte, t time.Time) []byte {
+	return appendFixed64(append(dst, fieldTime), uint64(t.UnixNano()))
+}
+
+// AppendDuration writes a duration in nanoseconds.
+func (Encoder) AppendDuration(dst []byte, d time.Duration) []byte {
+	return appendVarint(append(dst, fieldDuration), uint64(d))
+}
+
+// AppendBytes writes a byte slice value.
+func (Encoder) AppendBytes(dst []byte, b []byte) []byte {
+	dst = appendVarint(append(dst, fieldBytes), uint64(len(b)))
+	return append(dst, b...)
+}
+
+// AppendRaw writes pre-rendered data as a string field with an empty key, as
+// binary loggers do.
+func (e Encoder) AppendRaw(dst []byte, data []byte) []byte {
+	dst = e.AppendKey(dst, "")
+	dst = appendVarint(append(dst, fieldString), uint64(len(data)))
+	return append(dst, data...)
+}
+
+// End fills in the length of each Field message, adds the message, and fills
+// in the record length.
+func (Encoder) End(dst []byte, msgpos int, msg string) []byte {
+	start := msgpos - headerSize
+	for i := msgpos; i < len(dst); {
+		n := fieldLength(dst[i+1+lengthSize:])
+		putLength(dst[i+1:], n)
+		i += 1 + lengthSize + n
+	}
+	dst = appendString(dst, recordMessage, msg)
+	putLength(dst[start:], len(dst)-start-lengthSize)
+	return dst
+}
+
+// FieldLength returns the length of the Field message at the start of b,
+// which holds the key and value and then anything after them.
+func fieldLength(b []byte) int {
+	n := 0
+	for v := 0; v < 2; v++ {
+		tag := b[n]
+		n++
+		switch tag & 7 {
+		case 0:
+			for b[n] >= 0x80 {
+				n++
+			}
+			n++
+		case 1:
+			n += 8
+		case 2:
+			l, w := binary.Uvarint(b[n:])
+			n += w + int(l)
+		}
+	}
+	return n
+}
+
+// PutLength writes n into a length placeholder as a padded varint.
+func putLength(b []byte, n int) {
+	for i := 0; i < lengthSize-1; i++ {
+		b[i] = byte(n) | 0x80
+		n >>= 7
+	}
+	b[lengthSize-1] = byte(n)
+}
+
+func appendString(dst []byte, tag byte, s string) []byte {
+	dst = appendVarint(append(dst, tag), uint64(len(s)))
+	return append(dst, s...)
+}
+
+func appendFixed64(dst []byte, v uint64) []byte {
+	return append(dst, byte(v), byte(v>>8), byte(v>>16), byte(v>>24),
+		byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
+}
+
+func appendVarint(dst []byte, v uint64) []byte {
+	for v >= 0x80 {
+		dst = append(dst, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(dst, byte(v))
+}
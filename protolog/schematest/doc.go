@@ -0,0 +1,4 @@
+// Package schematest checks protolog's output against record.proto using the
+// protobuf runtime. It's a module of its own, so that blammo doesn't depend on
+// protobuf; it has no code apart from its tests.
+package schematest
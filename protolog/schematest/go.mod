@@ -0,0 +1,16 @@
+module github.com/lpar/blammo/protolog/schematest
+
+go 1.17
+
+require (
+	github.com/lpar/blammo v1.2.0
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	golang.org/x/crypto v0.0.0-20190128193316-c7b33c32a30b // indirect
+	golang.org/x/sys v0.0.0-20190124100055-b90733256f2e // indirect
+)
+
+// Test the protolog package in this tree, rather than a released version.
+replace github.com/lpar/blammo => ../../
@@ -0,0 +1,133 @@
+package schematest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/lpar/blammo/protolog"
+)
+
+// recordDescriptor is record.proto as a FileDescriptorProto, so that the
+// output can be checked against the schema without generated types.
+const recordDescriptor = `
+name: "record.proto"
+package: "blammo.v1"
+syntax: "proto3"
+enum_type {
+  name: "Level"
+  value { name: "LEVEL_UNSPECIFIED" number: 0 }
+  value { name: "LEVEL_DEBUG" number: 1 }
+  value { name: "LEVEL_INFO" number: 2 }
+  value { name: "LEVEL_WARN" number: 3 }
+  value { name: "LEVEL_ERROR" number: 4 }
+  value { name: "LEVEL_AUDIT" number: 5 }
+}
+message_type {
+  name: "Record"
+  field { name: "level" number: 1 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".blammo.v1.Level" }
+  field { name: "timestamp_unix_nano" number: 2 label: LABEL_OPTIONAL type: TYPE_SFIXED64 }
+  field { name: "message" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "fields" number: 4 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".blammo.v1.Field" }
+}
+message_type {
+  name: "Field"
+  field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "string_value" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+  field { name: "int_value" number: 3 label: LABEL_OPTIONAL type: TYPE_INT64 oneof_index: 0 }
+  field { name: "uint_value" number: 4 label: LABEL_OPTIONAL type: TYPE_UINT64 oneof_index: 0 }
+  field { name: "double_value" number: 5 label: LABEL_OPTIONAL type: TYPE_DOUBLE oneof_index: 0 }
+  field { name: "bool_value" number: 6 label: LABEL_OPTIONAL type: TYPE_BOOL oneof_index: 0 }
+  field { name: "time_unix_nano" number: 7 label: LABEL_OPTIONAL type: TYPE_SFIXED64 oneof_index: 0 }
+  field { name: "duration_nanos" number: 8 label: LABEL_OPTIONAL type: TYPE_INT64 oneof_index: 0 }
+  field { name: "bytes_value" number: 9 label: LABEL_OPTIONAL type: TYPE_BYTES oneof_index: 0 }
+  oneof_decl { name: "value" }
+}
+`
+
+func recordType(t *testing.T) protoreflect.MessageDescriptor {
+	var fdp descriptorpb.FileDescriptorProto
+	if err := prototext.Unmarshal([]byte(recordDescriptor), &fdp); err != nil {
+		t.Fatalf("bad descriptor: %v", err)
+	}
+	fd, err := protodesc.NewFile(&fdp, nil)
+	if err != nil {
+		t.Fatalf("bad descriptor: %v", err)
+	}
+	return fd.Messages().ByName("Record")
+}
+
+// fieldText describes a decoded Field message as key:kind=value.
+func fieldText(m protoreflect.Message) string {
+	fields := m.Descriptor().Fields()
+	v := m.WhichOneof(m.Descriptor().Oneofs().ByName("value"))
+	return fmt.Sprintf("%s:%s=%v", m.Get(fields.ByName("key")).String(), v.Name(), m.Get(v).Interface())
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	l := protolog.New(&buf)
+	when := time.Date(2019, 2, 3, 4, 5, 6, 7, time.UTC)
+	l.Warn().Str("s", "hello").Int("i", -42).Uint64("u", 42).Float64("f", 1.5).
+		Bool("b", true).Time("t", when).Any("d", time.Second).Bytes("x", []byte{0xde, 0xad}).
+		RawField([]byte("raw")).Msg("first")
+	l.Error().Str("long", strings.Repeat("x", 300)).Msg("second")
+
+	rt := recordType(t)
+	r := bufio.NewReader(&buf)
+	rec := dynamicpb.NewMessage(rt)
+	if err := protodelim.UnmarshalFrom(r, rec); err != nil {
+		t.Fatalf("unexpected error reading first record: %v", err)
+	}
+	if len(rec.GetUnknown()) != 0 {
+		t.Errorf("unknown fields in record: %x", rec.GetUnknown())
+	}
+	fields := rt.Fields()
+	if lvl := rec.Get(fields.ByName("level")).Enum(); lvl != 3 {
+		t.Errorf("got level %d, expected 3", lvl)
+	}
+	if ts := rec.Get(fields.ByName("timestamp_unix_nano")).Int(); time.Since(time.Unix(0, ts)) > time.Minute {
+		t.Errorf("got timestamp %v", time.Unix(0, ts))
+	}
+	if msg := rec.Get(fields.ByName("message")).String(); msg != "first" {
+		t.Errorf("got message %q", msg)
+	}
+	want := []string{
+		"s:string_value=hello", "i:int_value=-42", "u:uint_value=42", "f:double_value=1.5",
+		"b:bool_value=true", fmt.Sprintf("t:time_unix_nano=%d", when.UnixNano()),
+		"d:duration_nanos=1000000000", "x:bytes_value=[222 173]", ":string_value=raw",
+	}
+	list := rec.Get(fields.ByName("fields")).List()
+	if list.Len() != len(want) {
+		t.Fatalf("got %d fields, expected %d", list.Len(), len(want))
+	}
+	for i, w := range want {
+		f := list.Get(i).Message()
+		if got := fieldText(f); got != w || len(f.GetUnknown()) != 0 {
+			t.Errorf("got %s, expected %s", got, w)
+		}
+	}
+
+	rec = dynamicpb.NewMessage(rt)
+	if err := protodelim.UnmarshalFrom(r, rec); err != nil {
+		t.Fatalf("unexpected error reading second record: %v", err)
+	}
+	list = rec.Get(fields.ByName("fields")).List()
+	if rec.Get(fields.ByName("message")).String() != "second" || list.Len() != 1 ||
+		fieldText(list.Get(0).Message()) != "long:string_value="+strings.Repeat("x", 300) {
+		t.Errorf("got %v", rec)
+	}
+	if _, err := r.ReadByte(); err == nil {
+		t.Error("expected the end of the stream")
+	}
+}
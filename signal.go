@@ -0,0 +1,62 @@
+package blammo
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// WatchSignal starts a goroutine which changes the logger's minimum level each
+// time the process receives sig, moving to the next level in cycle and then
+// back to the first. For example:
+//
+//	stop := l.WatchSignal(syscall.SIGUSR1, []blammo.Level{blammo.InfoLevel, blammo.DebugLevel})
+//	defer stop()
+//
+// toggles debug logging. If the current level isn't in cycle, the first level
+// is used. Each change is made with SetLevel, and logged as a warning which is
+// written whatever the new level. Debug events still need a DebugWriter to go
+// anywhere. The function returned stops watching for the signal.
+func (l *Logger) WatchSignal(sig os.Signal, cycle []Level) (stop func()) {
+	if len(cycle) == 0 {
+		return func() {}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sig)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				l.cycleLevel(cycle)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// CycleLevel moves the minimum level on to the next level in cycle, and logs
+// the change.
+func (l *Logger) cycleLevel(cycle []Level) {
+	old := l.Level()
+	next := cycle[0]
+	for i, lvl := range cycle {
+		if lvl == old {
+			next = cycle[(i+1)%len(cycle)]
+			break
+		}
+	}
+	l.SetLevel(next)
+	e := l.makeEvent(WarnLevel, &l.ErrorWriter, l.WarnTag)
+	if e != nil {
+		e.Str("old", old.String()).Str("new", next.String()).Msg("log level changed")
+	}
+}
@@ -0,0 +1,414 @@
+// Package sqllog logs the queries made through a database/sql driver to a
+// blammo Logger, by wrapping the driver's Connector:
+//
+//	c := sqllog.New(connector, l)
+//	c.SlowThreshold = 500 * time.Millisecond
+//	db := sql.OpenDB(c)
+//
+// Each query and statement execution is logged at debug level, or at warning
+// level if it's slow or fails, with the SQL as sql, the arguments under args,
+// the time taken as duration and duration_ms, and the number of rows as rows.
+// For queries, the event is written when the rows are closed, so that the rows
+// can be counted and the time includes reading them.
+package sqllog
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/lpar/blammo"
+)
+
+// Connector is a driver.Connector which logs the queries made through the
+// connections it makes. Set its fields before passing it to sql.OpenDB.
+type Connector struct {
+	// SlowThreshold is how long a query can take before it's logged at warning
+	// level. Zero means queries are never treated as slow.
+	SlowThreshold time.Duration
+
+	// Redact, if set, is called for each argument, and if it returns true the
+	// value is logged as [REDACTED], for example to hide passwords.
+	Redact func(arg driver.NamedValue) bool
+
+	inner driver.Connector
+	l     *blammo.Logger
+}
+
+// New returns a Connector which makes connections using inner, and logs them
+// to l. Debug events need a DebugWriter to be written.
+func New(inner driver.Connector, l *blammo.Logger) *Connector {
+	return &Connector{inner: inner, l: l}
+}
+
+// Connect returns a logging connection made by the inner Connector.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dc, err := c.inner.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{c: c, inner: dc}, nil
+}
+
+// Driver returns the inner Connector's driver.
+func (c *Connector) Driver() driver.Driver {
+	return c.inner.Driver()
+}
+
+// event returns an event for a finished query, at a level depending on how
+// long it took and whether it failed.
+func (c *Connector) event(ctx context.Context, query string, args []driver.NamedValue, d time.Duration, err error) *blammo.Event {
+	var e *blammo.Event
+	if err != nil || (c.SlowThreshold > 0 && d >= c.SlowThreshold) {
+		e = c.l.Warn()
+	} else {
+		e = c.l.Debug()
+	}
+	if e == nil {
+		return e
+	}
+	e = e.Ctx(ctx).Str("sql", query)
+	if len(args) > 0 {
+		e = e.Object("args", func(e *blammo.Event) {
+			for _, arg := range args {
+				key := arg.Name
+				if key == "" {
+					key = strconv.Itoa(arg.Ordinal)
+				}
+				if c.Redact != nil && c.Redact(arg) {
+					e.Str(key, "[REDACTED]")
+				} else {
+					e.Any(key, arg.Value)
+				}
+			}
+		})
+	}
+	e = e.DurBoth("duration", d)
+	if err != nil {
+		e = e.Err(err)
+	}
+	return e
+}
+
+// conn logs the queries made through a driver connection.
+type conn struct {
+	c     *Connector
+	inner driver.Conn
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	st, err := c.inner.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return c.c.stmt(st, query), nil
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	pc, ok := c.inner.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	st, err := pc.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return c.c.stmt(st, query), nil
+}
+
+func (c *conn) Close() error {
+	return c.inner.Close()
+}
+
+// Begin is deprecated, but it's part of driver.Conn.
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.inner.Begin()
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bt, ok := c.inner.(driver.ConnBeginTx); ok {
+		return bt.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errors.New("sqllog: driver doesn't support transaction options")
+	}
+	return c.inner.Begin()
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var res driver.Result
+	var err error
+	if ec, ok := c.inner.(driver.ExecerContext); ok {
+		res, err = ec.ExecContext(ctx, query, args)
+	} else if ex, ok := c.inner.(driver.Execer); ok {
+		var vals []driver.Value
+		if vals, err = values(args); err != nil {
+			return nil, err
+		}
+		res, err = ex.Exec(query, vals)
+	} else {
+		return nil, driver.ErrSkip
+	}
+	if err == driver.ErrSkip {
+		return res, err
+	}
+	logResult(c.c.event(ctx, query, args, time.Since(start), err), res)
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rs driver.Rows
+	var err error
+	if qc, ok := c.inner.(driver.QueryerContext); ok {
+		rs, err = qc.QueryContext(ctx, query, args)
+	} else if q, ok := c.inner.(driver.Queryer); ok {
+		var vals []driver.Value
+		if vals, err = values(args); err != nil {
+			return nil, err
+		}
+		rs, err = q.Query(query, vals)
+	} else {
+		return nil, driver.ErrSkip
+	}
+	if err == driver.ErrSkip {
+		return rs, err
+	}
+	if err != nil {
+		c.c.event(ctx, query, args, time.Since(start), err).Msg("query failed")
+		return rs, err
+	}
+	return &rows{c: c.c, inner: rs, ctx: ctx, query: query, args: args, start: start}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.inner.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if sr, ok := c.inner.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := c.inner.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// stmt logs the executions of a prepared statement.
+type stmt struct {
+	c     *Connector
+	inner driver.Stmt
+	query string
+}
+
+// convStmt is a stmt whose inner statement converts its arguments column by
+// column. It's a separate type because database/sql handles arguments
+// differently for statements which implement driver.ColumnConverter, so the
+// wrapper mustn't claim to unless the inner statement does.
+type convStmt struct {
+	*stmt
+}
+
+func (s convStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return s.inner.(driver.ColumnConverter).ColumnConverter(idx)
+}
+
+// Stmt wraps a prepared statement, as a convStmt if it has column converters.
+func (c *Connector) stmt(st driver.Stmt, query string) driver.Stmt {
+	s := &stmt{c: c, inner: st, query: query}
+	if _, ok := st.(driver.ColumnConverter); ok {
+		return convStmt{s}
+	}
+	return s
+}
+
+func (s *stmt) Close() error {
+	return s.inner.Close()
+}
+
+func (s *stmt) NumInput() int {
+	return s.inner.NumInput()
+}
+
+// Exec is deprecated, but it's part of driver.Stmt.
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), named(args))
+}
+
+// Query is deprecated, but it's part of driver.Stmt.
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), named(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var res driver.Result
+	var err error
+	if sec, ok := s.inner.(driver.StmtExecContext); ok {
+		res, err = sec.ExecContext(ctx, args)
+	} else {
+		var vals []driver.Value
+		if vals, err = values(args); err != nil {
+			return nil, err
+		}
+		res, err = s.inner.Exec(vals)
+	}
+	logResult(s.c.event(ctx, s.query, args, time.Since(start), err), res)
+	return res, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rs driver.Rows
+	var err error
+	if sqc, ok := s.inner.(driver.StmtQueryContext); ok {
+		rs, err = sqc.QueryContext(ctx, args)
+	} else {
+		var vals []driver.Value
+		if vals, err = values(args); err != nil {
+			return nil, err
+		}
+		rs, err = s.inner.Query(vals)
+	}
+	if err != nil {
+		s.c.event(ctx, s.query, args, time.Since(start), err).Msg("query failed")
+		return rs, err
+	}
+	return &rows{c: s.c, inner: rs, ctx: ctx, query: s.query, args: args, start: start}, nil
+}
+
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := s.inner.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// rows counts the rows read from a query, and logs the query when closed. The
+// optional column type methods return what database/sql assumes when a driver
+// doesn't implement them.
+type rows struct {
+	c     *Connector
+	inner driver.Rows
+	ctx   context.Context
+	query string
+	args  []driver.NamedValue
+	start time.Time
+	n     int64
+	err   error
+}
+
+func (r *rows) Columns() []string {
+	return r.inner.Columns()
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	err := r.inner.Next(dest)
+	if err == nil {
+		r.n++
+	} else if err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *rows) Close() error {
+	err := r.inner.Close()
+	e := r.c.event(r.ctx, r.query, r.args, time.Since(r.start), r.err)
+	e.Int64("rows", r.n).Msg("query")
+	return err
+}
+
+func (r *rows) HasNextResultSet() bool {
+	if rs, ok := r.inner.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *rows) NextResultSet() error {
+	if rs, ok := r.inner.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if ct, ok := r.inner.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct, ok := r.inner.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *rows) ColumnTypeLength(index int) (int64, bool) {
+	if ct, ok := r.inner.(driver.RowsColumnTypeLength); ok {
+		return ct.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *rows) ColumnTypeNullable(index int) (bool, bool) {
+	if ct, ok := r.inner.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *rows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if ct, ok := r.inner.(driver.RowsColumnTypePrecisionScale); ok {
+		return ct.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+// logResult writes the event for an Exec, with the number of rows affected if
+// the driver reports it.
+func logResult(e *blammo.Event, res driver.Result) {
+	if res != nil {
+		if n, err := res.RowsAffected(); err == nil {
+			e = e.Int64("rows", n)
+		}
+	}
+	e.Msg("exec")
+}
+
+// values converts arguments for drivers which don't take named arguments.
+func values(args []driver.NamedValue) ([]driver.Value, error) {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sqllog: driver doesn't support named arguments")
+		}
+		vals[i] = arg.Value
+	}
+	return vals, nil
+}
+
+// named converts arguments from the deprecated Stmt methods.
+func named(args []driver.Value) []driver.NamedValue {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nvs[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nvs
+}
@@ -0,0 +1,231 @@
+package sqllog
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lpar/blammo"
+)
+
+// fakeConnector makes connections which are all conn.
+type fakeConnector struct {
+	conn driver.Conn
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return c.conn, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, errors.New("use the connector") }
+
+// fakeConn runs queries itself. A query of "fail" fails, and "skip" is left to
+// a prepared statement.
+type fakeConn struct {
+	stmt *fakeStmt
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return c.stmt, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no transactions") }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	switch query {
+	case "fail":
+		return nil, errors.New("boom")
+	case "skip":
+		return nil, driver.ErrSkip
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+// legacyConn only has the deprecated Execer, which can't take named arguments,
+// and leaves queries to prepared statements.
+type legacyConn struct {
+	stmt *fakeStmt
+}
+
+func (c *legacyConn) Prepare(query string) (driver.Stmt, error) { return c.stmt, nil }
+func (c *legacyConn) Close() error                              { return nil }
+func (c *legacyConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no transactions") }
+
+func (c *legacyConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+// fakeStmt takes one argument, which its column converter marks, and records
+// the arguments it's run with.
+type fakeStmt struct {
+	args []driver.Value
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return 1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.args = args
+	return driver.RowsAffected(2), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.args = args
+	return &fakeRows{}, nil
+}
+
+func (s *fakeStmt) ColumnConverter(idx int) driver.ValueConverter { return markConverter{} }
+
+type markConverter struct{}
+
+func (markConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	return fmt.Sprintf("converted %v", v), nil
+}
+
+// fakeRows has three rows.
+type fakeRows struct {
+	n int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n == 3 {
+		return io.EOF
+	}
+	r.n++
+	dest[0] = r.n
+	return nil
+}
+
+// open returns a database using conn through a logging Connector, and the
+// buffer the queries are logged to.
+func open(conn driver.Conn) (*sql.DB, *Connector, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l := blammo.NewCloudLogger()
+	l.ErrorWriter = &buf
+	l.InfoWriter = &buf
+	l.DebugWriter = &buf
+	c := New(fakeConnector{conn}, l)
+	return sql.OpenDB(c), c, &buf
+}
+
+// checkLog fails the test unless the output is a single line starting with
+// prefix and including each of the fields.
+func checkLog(t *testing.T, buf *bytes.Buffer, prefix string, fields ...string) {
+	t.Helper()
+	line := buf.String()
+	buf.Reset()
+	if strings.Count(line, "\n") != 1 || !strings.HasPrefix(line, prefix) {
+		t.Errorf("got %q, expected one line starting %q", line, prefix)
+		return
+	}
+	for _, f := range fields {
+		if !strings.Contains(line, " "+f+" ") && !strings.HasSuffix(line, " "+f+"\n") {
+			t.Errorf("got %q, expected %s", line, f)
+		}
+	}
+}
+
+func TestExecQuery(t *testing.T) {
+	db, c, buf := open(&fakeConn{stmt: &fakeStmt{}})
+	defer db.Close()
+	if _, err := db.Exec("INSERT", 42); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkLog(t, buf, "[DEBUG] exec ", "sql=INSERT", "args.1=42", "rows=1")
+
+	rs, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %q before the rows were read", buf.String())
+	}
+	for rs.Next() {
+	}
+	rs.Close()
+	checkLog(t, buf, "[DEBUG] query ", "sql=SELECT", "rows=3")
+
+	if _, err := db.Exec("fail"); err == nil {
+		t.Error("expected an error")
+	}
+	checkLog(t, buf, "[WARN ] exec ", "sql=fail", "@error=boom")
+
+	c.SlowThreshold = time.Nanosecond
+	db.Exec("INSERT")
+	checkLog(t, buf, "[WARN ] exec ", "sql=INSERT")
+}
+
+func TestRedact(t *testing.T) {
+	db, c, buf := open(&fakeConn{stmt: &fakeStmt{}})
+	defer db.Close()
+	c.Redact = func(arg driver.NamedValue) bool {
+		return arg.Name == "password"
+	}
+	if _, err := db.Exec("UPDATE", sql.Named("user", "bob"), sql.Named("password", "secret")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkLog(t, buf, "[DEBUG] exec ", "args.user=bob", "args.password=[REDACTED]")
+}
+
+func TestNamedArgs(t *testing.T) {
+	db, _, buf := open(&legacyConn{stmt: &fakeStmt{}})
+	defer db.Close()
+	_, err := db.Exec("UPDATE", sql.Named("user", "bob"))
+	if err == nil || !strings.Contains(err.Error(), "named arguments") {
+		t.Errorf("got %v, expected named arguments to be rejected", err)
+	}
+	if _, err = db.Exec("UPDATE", "bob"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	checkLog(t, buf, "[DEBUG] exec ", "args.1=bob", "rows=1")
+}
+
+func TestErrSkip(t *testing.T) {
+	st := &fakeStmt{}
+	db, _, buf := open(&fakeConn{stmt: st})
+	defer db.Close()
+	// The statement's column converter shows the statement ran the query
+	if _, err := db.Exec("skip", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkLog(t, buf, "[DEBUG] exec ", "sql=skip", "rows=2")
+	if len(st.args) != 1 || st.args[0] != "converted 1" {
+		t.Errorf("got statement arguments %q", st.args)
+	}
+
+	st = &fakeStmt{}
+	db, _, buf = open(&legacyConn{stmt: st})
+	defer db.Close()
+	rs, err := db.Query("SELECT", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rs.Close()
+	checkLog(t, buf, "[DEBUG] query ", "sql=SELECT", "rows=0")
+	if len(st.args) != 1 || st.args[0] != "converted 1" {
+		t.Errorf("got statement arguments %q", st.args)
+	}
+}
+
+func TestColumnConverter(t *testing.T) {
+	c := New(fakeConnector{}, blammo.NewCloudLogger())
+	if _, ok := c.stmt(&fakeStmt{}, "").(driver.ColumnConverter); !ok {
+		t.Error("column converter hidden")
+	}
+	if _, ok := c.stmt(struct{ driver.Stmt }{&fakeStmt{}}, "").(driver.ColumnConverter); ok {
+		t.Error("column converter added")
+	}
+}
@@ -0,0 +1,69 @@
+package blammo
+
+import (
+	"bytes"
+)
+
+// StdWriter is an io.Writer which turns each line written to it into a log
+// event, so that output from the standard library's log package, or anything
+// else which writes lines of text, can be captured. For example:
+//
+//	log.SetFlags(0)
+//	log.SetOutput(&blammo.StdWriter{Logger: l, DetectLevel: true})
+type StdWriter struct {
+	Logger *Logger
+	Level  Level // level for the events; zero means InfoLevel
+
+	// DetectLevel makes the writer look for an ERROR, WARN, WARNING, INFO or
+	// DEBUG token at the start of each line, in any case and optionally in
+	// square brackets or followed by a colon. If one is found, it's removed
+	// from the message and the event is logged at the matching level.
+	DetectLevel bool
+}
+
+// Write logs each non-empty line of p as a separate event.
+func (w *StdWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		lvl := w.Level
+		if lvl == 0 {
+			lvl = InfoLevel
+		}
+		if w.DetectLevel {
+			if dl, msg, ok := detectLevel(line); ok {
+				lvl = dl
+				line = msg
+			}
+		}
+		// Audit events get the file and line of the code which called Write
+		w.Logger.event(lvl, 1).Msg(string(line))
+	}
+	return len(p), nil
+}
+
+// DetectLevel looks for a level name at the start of a line of text, and if
+// one is found returns the level and the rest of the line.
+func detectLevel(line []byte) (Level, []byte, bool) {
+	tok := bytes.TrimLeft(line, " ")
+	tok = bytes.TrimPrefix(tok, []byte{'['})
+	end := bytes.IndexAny(tok, ":] ")
+	if end < 0 {
+		end = len(tok)
+	}
+	var lvl Level
+	switch word := tok[:end]; {
+	case bytes.EqualFold(word, []byte("ERROR")):
+		lvl = ErrorLevel
+	case bytes.EqualFold(word, []byte("WARN")), bytes.EqualFold(word, []byte("WARNING")):
+		lvl = WarnLevel
+	case bytes.EqualFold(word, []byte("INFO")):
+		lvl = InfoLevel
+	case bytes.EqualFold(word, []byte("DEBUG")):
+		lvl = DebugLevel
+	default:
+		return 0, line, false
+	}
+	return lvl, bytes.TrimLeft(tok[end:], ":] "), true
+}
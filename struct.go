@@ -0,0 +1,108 @@
+package blammo
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// How many levels of nested structs Struct will descend into, which also stops
+// it going round in circles on self-referential data.
+const maxStructDepth = 8
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Struct adds the exported fields of a struct to the logging event, with keys
+// of the form prefix.FieldName. A `log:"name"` struct tag changes the name
+// used for a field, and `log:"-"` leaves the field out. Pointers are followed,
+// and nested structs are flattened into prefix.Field.SubField keys. If v isn't
+// a struct, it's logged using the prefix as the key.
+//
+// Struct uses reflection and allocates, so it's a debugging convenience rather
+// than something to use on hot code paths.
+func (e *Event) Struct(prefix string, v interface{}) *Event {
+	if e == nil {
+		return e
+	}
+	e.reflectValue(prefix, reflect.ValueOf(v), 0)
+	return e
+}
+
+func (e *Event) reflectValue(key string, v reflect.Value, depth int) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			e.Str(key, "nil")
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		e.Str(key, "nil")
+	case reflect.String:
+		e.Str(key, v.String())
+	case reflect.Bool:
+		e.Bool(key, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.Int64(key, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.Uint64(key, v.Uint())
+	case reflect.Float32:
+		e.Float32(key, float32(v.Float()))
+	case reflect.Float64:
+		e.Float64(key, v.Float())
+	case reflect.Struct:
+		if v.Type() == timeType {
+			e.Time(key, v.Interface().(time.Time))
+			return
+		}
+		if depth >= maxStructDepth {
+			e.Str(key, "...")
+			return
+		}
+		e.reflectStruct(key, v, depth+1)
+	default:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			e.Bytes(key, v.Bytes())
+			return
+		}
+		e.Str(key, fmt.Sprint(v.Interface()))
+	}
+}
+
+func (e *Event) reflectStruct(prefix string, v reflect.Value, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("log"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		e.reflectValue(name, v.Field(i), depth)
+	}
+}
+
+// ChanLen adds the number of items queued in a channel and the channel's
+// capacity to the logging event, as key.len and key.cap. If ch isn't a
+// channel, a message saying so is logged as key instead.
+func (e *Event) ChanLen(key string, ch interface{}) *Event {
+	if e == nil {
+		return e
+	}
+	v := reflect.ValueOf(ch)
+	if v.Kind() != reflect.Chan {
+		return e.Str(key, fmt.Sprintf("not a channel: %T", ch))
+	}
+	return e.Int(key+".len", v.Len()).Int(key+".cap", v.Cap())
+}
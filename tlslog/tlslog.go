@@ -0,0 +1,46 @@
+// Package tlslog logs the state of TLS connections to blammo events, for
+// debugging handshakes. It's kept separate so that only code which uses TLS
+// depends on crypto/tls.
+//
+//	tlslog.State(l.Debug(), r.TLS).Msg("request")
+package tlslog
+
+import (
+	"crypto/tls"
+	"strconv"
+
+	"github.com/lpar/blammo"
+)
+
+// State adds the TLS connection state to an event as @tls.version,
+// @tls.cipher_suite, @tls.server_name and @tls.handshake_complete. If cs is
+// nil, meaning the connection doesn't use TLS, @tls=none is added instead.
+func State(e *blammo.Event, cs *tls.ConnectionState) *blammo.Event {
+	if cs == nil {
+		return e.Str("@tls", "none")
+	}
+	return e.Object("@tls", func(e *blammo.Event) {
+		e.Str("version", versionName(cs.Version)).
+			Str("cipher_suite", tls.CipherSuiteName(cs.CipherSuite)).
+			Str("server_name", cs.ServerName).
+			Bool("handshake_complete", cs.HandshakeComplete)
+	})
+}
+
+// VersionName returns the name of a TLS version, or its hex value if it's
+// not known.
+func versionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLSv1.0"
+	case tls.VersionTLS11:
+		return "TLSv1.1"
+	case tls.VersionTLS12:
+		return "TLSv1.2"
+	case tls.VersionTLS13:
+		return "TLSv1.3"
+	case tls.VersionSSL30:
+		return "SSLv3"
+	}
+	return "0x" + strconv.FormatUint(uint64(v), 16)
+}
@@ -0,0 +1,58 @@
+package blammo
+
+import (
+	"fmt"
+	"net"
+)
+
+// UnixgramMaxSize is the largest datagram a unixgram logger will send. Longer
+// lines are truncated to this size, keeping the trailing newline.
+const UnixgramMaxSize = 64 * 1024
+
+// NewUnixgramLogger creates a new logger which sends each event as a single
+// datagram to the Unix datagram socket at path, with no ANSI codes and
+// timestamps to 1 second precision. Events longer than UnixgramMaxSize are
+// truncated. Close the logger to close the socket.
+func NewUnixgramLogger(path string) (*Logger, error) {
+	conn, err := net.Dial("unixgram", path)
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to log socket: %w", err)
+	}
+	w := datagramWriter{conn}
+	l := &Logger{
+		ErrorWriter:   w,
+		InfoWriter:    w,
+		DebugWriter:   nil,
+		Timestamp:     timestampFormat,
+		MaxCallLevels: 3,
+		ErrorTag:      []byte("[ERROR] "),
+		WarnTag:       []byte("[WARN ] "),
+		InfoTag:       []byte("[INFO ] "),
+		DebugTag:      []byte("[DEBUG] "),
+		AuditTag:      []byte("[AUDIT] "),
+		KeyStart:      []byte(""),
+		KeyEnd:        []byte(""),
+		Closer: func() {
+			conn.Close()
+		},
+	}
+	return l, nil
+}
+
+// datagramWriter truncates each write to UnixgramMaxSize before sending it.
+type datagramWriter struct {
+	conn net.Conn
+}
+
+func (w datagramWriter) Write(p []byte) (int, error) {
+	if len(p) <= UnixgramMaxSize {
+		return w.conn.Write(p)
+	}
+	d := make([]byte, UnixgramMaxSize)
+	copy(d, p)
+	d[len(d)-1] = p[len(p)-1]
+	if _, err := w.conn.Write(d); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}